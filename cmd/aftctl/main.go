@@ -0,0 +1,512 @@
+// Command aftctl inspects and perturbs a running simulator.
+//
+//	aftctl [flags] show rib <prefix>
+//	aftctl [flags] show fib
+//	aftctl [flags] lookup <address>
+//	aftctl [flags] show mpls
+//	aftctl [flags] inject route <prefix> <next-hop> [metric]
+//	aftctl [flags] withdraw route <prefix>
+//	aftctl [flags] inject label <label> <next-hop> [pushed-labels]
+//	aftctl [flags] withdraw label <label>
+//	aftctl [flags] flap nexthop <address> [down-duration]
+//	aftctl [flags] subscribers
+//	aftctl [flags] watch [path]
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/admin"
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/fib"
+	"github.com/openconfig/aft-simulator/pkg/rib"
+	"github.com/openconfig/aft-simulator/pkg/security"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+var (
+	addr       = flag.String("addr", "localhost:50099", "Address of the simulator gRPC server")
+	useTLS     = flag.Bool("tls", false, "Connect with TLS")
+	caFile     = flag.String("ca", "", "CA bundle used to verify the server with -tls")
+	skipVerify = flag.Bool("skip-verify", false, "Skip server certificate verification with -tls")
+	username   = flag.String("username", "", "Username for authentication")
+	password   = flag.String("password", "", "Password for authentication")
+	timeout    = flag.Duration("timeout", 10*time.Second, "Timeout of non-streaming commands, and of each step of flap")
+)
+
+const usage = `Usage: aftctl [flags] <command>
+
+Commands:
+  show rib <prefix>                         Candidate routes and best path of a prefix
+  show fib                                  Installed prefixes
+  show mpls                                 Installed MPLS label entries
+  lookup <address>                          Longest-prefix match in the FIB
+  inject route <prefix> <next-hop> [metric] Install a static route; the next hop is an
+                                            address, drop, receive or interface:<name>
+  withdraw route <prefix>                   Remove a static route
+  inject label <label> <next-hop> [pushed-labels]
+                                            Install a static label entry, swapping the label
+                                            for pushed-labels (e.g. 16001/16002) or popping it
+  withdraw label <label>                    Remove a static label entry
+  flap nexthop <address> [down-duration]    Mark a next hop down, then up again (default 1s)
+  subscribers                               Active telemetry receivers
+  watch [path]                              Stream AFT changes as a diff
+
+Flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "aftctl: %v\n", err)
+		var u usageError
+		if errors.As(err, &u) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// usageError reports invalid command-line arguments.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func run(args []string) error {
+	creds, err := security.ClientCredentials(*useTLS, *caFile, *skipVerify)
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *username != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, security.UsernameKey, *username, security.PasswordKey, *password)
+	}
+	c := &cli{admin: admin.NewClient(conn), gnmi: gnmipb.NewGNMIClient(conn)}
+
+	cmd := args[0]
+	if len(args) > 1 && (cmd == "show" || cmd == "inject" || cmd == "withdraw" || cmd == "flap") {
+		cmd += " " + args[1]
+		args = args[1:]
+	}
+	args = args[1:]
+	if cmd == "watch" {
+		path := "/network-instances/network-instance/afts"
+		if len(args) > 0 {
+			path = args[0]
+		}
+		return c.watch(ctx, path)
+	}
+	if cmd == "flap nexthop" {
+		// The down phase may outlast the timeout, which applies to each of
+		// the Set requests instead.
+		if len(args) != 1 && len(args) != 2 {
+			return usageError("flap nexthop <address> [down-duration]")
+		}
+		return c.flapNextHop(ctx, args)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	switch cmd {
+	case "show rib":
+		if len(args) != 1 {
+			return usageError("show rib <prefix>")
+		}
+		return c.showRIB(ctx, args[0])
+	case "show fib":
+		return c.showFIB(ctx)
+	case "show mpls":
+		return c.showMPLS(ctx)
+	case "lookup":
+		if len(args) != 1 {
+			return usageError("lookup <address>")
+		}
+		return c.lookup(ctx, args[0])
+	case "inject route":
+		if len(args) != 2 && len(args) != 3 {
+			return usageError("inject route <prefix> <next-hop> [metric]")
+		}
+		return c.injectRoute(ctx, args)
+	case "withdraw route":
+		if len(args) != 1 {
+			return usageError("withdraw route <prefix>")
+		}
+		return c.withdrawRoute(ctx, args[0])
+	case "inject label":
+		if len(args) != 2 && len(args) != 3 {
+			return usageError("inject label <label> <next-hop> [pushed-labels]")
+		}
+		return c.injectLabel(ctx, args)
+	case "withdraw label":
+		if len(args) != 1 {
+			return usageError("withdraw label <label>")
+		}
+		return c.withdrawLabel(ctx, args[0])
+	case "subscribers":
+		return c.subscribers(ctx)
+	}
+	return usageError(fmt.Sprintf("unknown command %q; run aftctl -h for usage", cmd))
+}
+
+type cli struct {
+	admin *admin.Client
+	gnmi  gnmipb.GNMIClient
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+func (c *cli) showRIB(ctx context.Context, arg string) error {
+	prefix, err := netip.ParsePrefix(arg)
+	if err != nil {
+		return err
+	}
+	resp, err := c.admin.GetRIB(ctx, &admin.GetRIBRequest{Prefix: prefix})
+	if err != nil {
+		return err
+	}
+	state := resp.State
+	fmt.Printf("%s\n", state.Prefix)
+	w := newTable()
+	fmt.Fprintln(w, "\tPROTOCOL\tSOURCE\tNEXT-HOP\tAD\tMETRIC\tREACHABLE\tATTRIBUTES\tNOT BEST BECAUSE")
+	for _, cand := range state.Candidates {
+		mark := ""
+		if state.Best != nil && cand.Reason == "" {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%t\t%s\t%s\n", mark, cand.Protocol, formatSource(cand.RouteEntry),
+			api.NextHopString(cand.NextHopType, cand.NextHop, cand.Interface, cand.PushedLabels), cand.AdminDist, cand.Metric, cand.Reachable,
+			formatBGP(cand.BGP), cand.Reason)
+	}
+	w.Flush()
+	switch {
+	case state.Best == nil:
+		fmt.Println("No reachable path")
+	case state.ExportFiltered:
+		fmt.Println("Best path rejected by the export policy, not installed")
+	case state.Suppressed:
+		fmt.Println("Best path suppressed by a summary-only aggregate, not installed")
+	}
+	return nil
+}
+
+// formatSource formats the source and path ID of a route, or returns "-".
+func formatSource(e rib.RouteEntry) string {
+	switch {
+	case e.PathID != 0:
+		return fmt.Sprintf("%s#%d", cmp.Or(e.Source, "-"), e.PathID)
+	case e.Source != "":
+		return e.Source
+	default:
+		return "-"
+	}
+}
+
+// formatBGP summarizes the BGP attributes of a route, or returns "-".
+func formatBGP(a *api.BGPAttributes) string {
+	if a == nil {
+		return "-"
+	}
+	parts := []string{
+		fmt.Sprintf("local-pref=%d", a.LocalPref),
+		fmt.Sprintf("as-path=%s", strings.Trim(fmt.Sprint(a.ASPath), "[]")),
+		fmt.Sprintf("origin=%s", a.Origin),
+		fmt.Sprintf("med=%d", a.MED),
+	}
+	if a.EBGP {
+		parts = append(parts, "ebgp")
+	}
+	if a.Neighbor.IsValid() {
+		parts = append(parts, fmt.Sprintf("neighbor=%s", a.Neighbor))
+	}
+	if len(a.Communities) > 0 {
+		parts = append(parts, fmt.Sprintf("communities=%s", strings.Join(a.Communities, ",")))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *cli) showFIB(ctx context.Context) error {
+	resp, err := c.admin.ListFIB(ctx, &admin.ListFIBRequest{})
+	if err != nil {
+		return err
+	}
+	w := newTable()
+	fmt.Fprintln(w, "PREFIX\tNEXT-HOP\tNHG\tLAST-CHANGE")
+	for _, e := range resp.Entries {
+		printEntry(w, e)
+	}
+	w.Flush()
+	fmt.Printf("%d prefixes\n", len(resp.Entries))
+	return nil
+}
+
+func printEntry(w *tabwriter.Writer, e fib.Entry) {
+	fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", e.Prefix, api.NextHopString(e.NextHopType, e.NextHop, e.Interface, e.PushedLabels), e.NextHopGroup, e.LastChange.Format(time.RFC3339Nano))
+}
+
+func (c *cli) showMPLS(ctx context.Context) error {
+	resp, err := c.admin.ListFIB(ctx, &admin.ListFIBRequest{})
+	if err != nil {
+		return err
+	}
+	w := newTable()
+	fmt.Fprintln(w, "LABEL\tOPERATION\tNEXT-HOP\tNHG\tLAST-CHANGE")
+	for _, e := range resp.LabelEntries {
+		op := "pop"
+		if len(e.PushedLabels) > 0 {
+			op = "swap " + e.PushedLabels.String()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", e.Label, op, api.NextHopString(e.NextHopType, e.NextHop, e.Interface, nil),
+			e.NextHopGroup, e.LastChange.Format(time.RFC3339Nano))
+	}
+	w.Flush()
+	fmt.Printf("%d label entries\n", len(resp.LabelEntries))
+	return nil
+}
+
+func (c *cli) lookup(ctx context.Context, arg string) error {
+	ip, err := netip.ParseAddr(arg)
+	if err != nil {
+		return err
+	}
+	resp, err := c.admin.ListFIB(ctx, &admin.ListFIBRequest{})
+	if err != nil {
+		return err
+	}
+	var best *fib.Entry
+	for i, e := range resp.Entries {
+		if e.Prefix.Contains(ip) && (best == nil || e.Prefix.Bits() > best.Prefix.Bits()) {
+			best = &resp.Entries[i]
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("no route to %s", ip)
+	}
+	w := newTable()
+	fmt.Fprintln(w, "PREFIX\tNEXT-HOP\tNHG\tLAST-CHANGE")
+	printEntry(w, *best)
+	return w.Flush()
+}
+
+func (c *cli) subscribers(ctx context.Context) error {
+	resp, err := c.admin.ListSubscribers(ctx, &admin.ListSubscribersRequest{})
+	if err != nil {
+		return err
+	}
+	w := newTable()
+	fmt.Fprintln(w, "ID\tREMOTE\tPOLICY\tQUEUE\tSENT")
+	for _, s := range resp.Subscribers {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d/%d\t%d\n", s.ID, s.Remote, s.Policy, s.QueueDepth, s.QueueSize, s.Sent)
+	}
+	return w.Flush()
+}
+
+// staticRoutePath returns the path of a static route leaf in the simulator
+// configuration subtree.
+func staticRoutePath(prefix netip.Prefix, leaf string) *gnmipb.Path {
+	return simEntryPath("static-routes", "static-route", "prefix", prefix.String(), leaf)
+}
+
+// labelEntryPath returns the path of a label entry leaf in the simulator
+// configuration subtree.
+func labelEntryPath(label uint64, leaf string) *gnmipb.Path {
+	return simEntryPath("mpls", "label-entry", "label", strconv.FormatUint(label, 10), leaf)
+}
+
+// simEntryPath returns the path of a leaf of the list entry with the given
+// key in the simulator configuration subtree, or of the entry itself if
+// leaf is empty.
+func simEntryPath(container, list, key, value, leaf string) *gnmipb.Path {
+	p := &gnmipb.Path{Elem: []*gnmipb.PathElem{
+		{Name: "simulator"},
+		{Name: container},
+		{Name: list, Key: map[string]string{key: value}},
+	}}
+	if leaf != "" {
+		p.Elem = append(p.Elem, &gnmipb.PathElem{Name: "config"}, &gnmipb.PathElem{Name: leaf})
+	}
+	return p
+}
+
+// setNextHop returns a request setting the next hop of the simulator entry
+// whose leaves are addressed by path. The next hop is an address, drop,
+// receive or interface:<name>. The other of the next-hop and interface
+// leaves is cleared, as an entry cannot have both.
+func setNextHop(path func(leaf string) *gnmipb.Path, arg string) (*gnmipb.SetRequest, error) {
+	leaf, other, nh := "next-hop", "interface", arg
+	if name, ok := strings.CutPrefix(nh, "interface:"); ok {
+		leaf, other, nh = "interface", "next-hop", name
+	} else if typ := api.NextHopType(strings.ToUpper(nh)); typ == api.NextHopDrop || typ == api.NextHopReceive {
+		nh = string(typ)
+	} else if _, err := netip.ParseAddr(nh); err != nil {
+		return nil, err
+	}
+	return &gnmipb.SetRequest{
+		Delete: []*gnmipb.Path{path(other)},
+		Update: []*gnmipb.Update{{
+			Path: path(leaf),
+			Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: nh}},
+		}},
+	}, nil
+}
+
+func (c *cli) injectRoute(ctx context.Context, args []string) error {
+	prefix, err := netip.ParsePrefix(args[0])
+	if err != nil {
+		return err
+	}
+	req, err := setNextHop(func(leaf string) *gnmipb.Path { return staticRoutePath(prefix, leaf) }, args[1])
+	if err != nil {
+		return err
+	}
+	if len(args) == 3 {
+		metric, err := strconv.ParseUint(args[2], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid metric %q", args[2])
+		}
+		req.Update = append(req.Update, &gnmipb.Update{
+			Path: staticRoutePath(prefix, "metric"),
+			Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_UintVal{UintVal: metric}},
+		})
+	}
+	if _, err := c.gnmi.Set(ctx, req); err != nil {
+		return err
+	}
+	fmt.Printf("Injected %s via %s\n", prefix, args[1])
+	return nil
+}
+
+func (c *cli) injectLabel(ctx context.Context, args []string) error {
+	label, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil || label < api.MinLabel || label > api.MaxLabel {
+		return fmt.Errorf("invalid label %q", args[0])
+	}
+	path := func(leaf string) *gnmipb.Path { return labelEntryPath(label, leaf) }
+	req, err := setNextHop(path, args[1])
+	if err != nil {
+		return err
+	}
+	op := "popping"
+	if len(args) == 3 {
+		labels, err := api.ParseLabelStack(args[2])
+		if err != nil {
+			return err
+		}
+		req.Update = append(req.Update, &gnmipb.Update{
+			Path: path("pushed-mpls-label-stack"),
+			Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: labels.String()}},
+		})
+		op = "swapping to " + labels.String()
+	} else {
+		req.Delete = append(req.Delete, path("pushed-mpls-label-stack"))
+	}
+	if _, err := c.gnmi.Set(ctx, req); err != nil {
+		return err
+	}
+	fmt.Printf("Injected label %d via %s, %s\n", label, args[1], op)
+	return nil
+}
+
+func (c *cli) withdrawLabel(ctx context.Context, arg string) error {
+	label, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid label %q", arg)
+	}
+	if _, err := c.gnmi.Set(ctx, &gnmipb.SetRequest{Delete: []*gnmipb.Path{labelEntryPath(label, "")}}); err != nil {
+		return err
+	}
+	fmt.Printf("Withdrew label %d\n", label)
+	return nil
+}
+
+func (c *cli) withdrawRoute(ctx context.Context, arg string) error {
+	prefix, err := netip.ParsePrefix(arg)
+	if err != nil {
+		return err
+	}
+	if _, err := c.gnmi.Set(ctx, &gnmipb.SetRequest{Delete: []*gnmipb.Path{staticRoutePath(prefix, "")}}); err != nil {
+		return err
+	}
+	fmt.Printf("Withdrew %s\n", prefix)
+	return nil
+}
+
+func (c *cli) flapNextHop(ctx context.Context, args []string) error {
+	nh, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return err
+	}
+	down := time.Second
+	if len(args) == 2 {
+		if down, err = time.ParseDuration(args[1]); err != nil {
+			return err
+		}
+	}
+
+	setCtx, cancel := context.WithTimeout(ctx, *timeout)
+	err = c.setNextHopEnabled(setCtx, nh, false)
+	cancel()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Next hop %s down\n", nh)
+	var interrupted error
+	select {
+	case <-time.After(down):
+	case <-ctx.Done():
+		interrupted = fmt.Errorf("interrupted before %s elapsed: %w", down, ctx.Err())
+	}
+	// Restore the next hop even if interrupted.
+	setCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), *timeout)
+	defer cancel()
+	if err := c.setNextHopEnabled(setCtx, nh, true); err != nil {
+		return err
+	}
+	fmt.Printf("Next hop %s up\n", nh)
+	return interrupted
+}
+
+func (c *cli) setNextHopEnabled(ctx context.Context, nh netip.Addr, enabled bool) error {
+	_, err := c.gnmi.Set(ctx, &gnmipb.SetRequest{Update: []*gnmipb.Update{{
+		Path: &gnmipb.Path{Elem: []*gnmipb.PathElem{
+			{Name: "simulator"},
+			{Name: "next-hops"},
+			{Name: "next-hop", Key: map[string]string{"address": nh.String()}},
+			{Name: "config"},
+			{Name: "enabled"},
+		}},
+		Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_BoolVal{BoolVal: enabled}},
+	}}})
+	return err
+}
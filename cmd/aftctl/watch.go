@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/telemetry"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// watch subscribes to path and prints every change as a diff against the
+// state received so far: "+" for new leaves, "~" for changed leaves and "-"
+// for removed ones. The initial snapshot is summarized rather than printed.
+func (c *cli) watch(ctx context.Context, path string) error {
+	p, err := telemetry.ParsePath(path)
+	if err != nil {
+		return err
+	}
+	stream, err := c.gnmi.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&gnmipb.SubscribeRequest{Request: &gnmipb.SubscribeRequest_Subscribe{
+		Subscribe: &gnmipb.SubscriptionList{
+			Mode:         gnmipb.SubscriptionList_STREAM,
+			Encoding:     gnmipb.Encoding_PROTO,
+			Subscription: []*gnmipb.Subscription{{Path: p}},
+		},
+	}}); err != nil {
+		return err
+	}
+
+	d := &differ{state: make(map[string]string)}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if resp.GetSyncResponse() {
+			fmt.Printf("--- synced: %d leaves ---\n", len(d.state))
+			d.synced = true
+			continue
+		}
+		if lines := d.apply(resp.GetUpdate()); d.synced && len(lines) > 0 {
+			ts := time.Unix(0, resp.GetUpdate().GetTimestamp())
+			fmt.Printf("%s\n", ts.Format(time.RFC3339Nano))
+			for _, l := range lines {
+				fmt.Printf("  %s\n", l)
+			}
+		}
+	}
+}
+
+// differ tracks the leaves received on a subscription.
+type differ struct {
+	state  map[string]string
+	synced bool
+}
+
+// apply updates the state with notif and returns the resulting diff lines.
+func (d *differ) apply(notif *gnmipb.Notification) []string {
+	prefix := telemetry.PathString(notif.GetPrefix())
+	var lines []string
+	for _, del := range notif.GetDelete() {
+		root := prefix + telemetry.PathString(del)
+		var removed []string
+		for leaf := range d.state {
+			if leaf == root || strings.HasPrefix(leaf, root+"/") {
+				removed = append(removed, leaf)
+			}
+		}
+		sort.Strings(removed)
+		for _, leaf := range removed {
+			delete(d.state, leaf)
+			lines = append(lines, "- "+leaf)
+		}
+	}
+	for _, u := range notif.GetUpdate() {
+		leaf := prefix + telemetry.PathString(u.GetPath())
+		val := formatValue(u.GetVal())
+		old, ok := d.state[leaf]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("+ %s = %s", leaf, val))
+		case old != val:
+			lines = append(lines, fmt.Sprintf("~ %s = %s -> %s", leaf, old, val))
+		}
+		d.state[leaf] = val
+	}
+	return lines
+}
+
+func formatValue(v *gnmipb.TypedValue) string {
+	switch v := v.GetValue().(type) {
+	case *gnmipb.TypedValue_StringVal:
+		return v.StringVal
+	case *gnmipb.TypedValue_UintVal:
+		return fmt.Sprint(v.UintVal)
+	case *gnmipb.TypedValue_IntVal:
+		return fmt.Sprint(v.IntVal)
+	case *gnmipb.TypedValue_BoolVal:
+		return fmt.Sprint(v.BoolVal)
+	case *gnmipb.TypedValue_JsonVal:
+		return string(v.JsonVal)
+	case *gnmipb.TypedValue_JsonIetfVal:
+		return string(v.JsonIetfVal)
+	}
+	return prototext.Format(v)
+}
@@ -2,19 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net"
+	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/openconfig/aft-simulator/pkg/admin"
 	"github.com/openconfig/aft-simulator/pkg/api"
 	"github.com/openconfig/aft-simulator/pkg/config"
 	"github.com/openconfig/aft-simulator/pkg/fib"
 	"github.com/openconfig/aft-simulator/pkg/installers/mock"
+	"github.com/openconfig/aft-simulator/pkg/latency"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+	"github.com/openconfig/aft-simulator/pkg/policy"
 	"github.com/openconfig/aft-simulator/pkg/rib"
+	"github.com/openconfig/aft-simulator/pkg/security"
 	"github.com/openconfig/aft-simulator/pkg/telemetry"
 	pb "github.com/openconfig/gnmi/proto/gnmi"
 	"golang.org/x/sync/errgroup"
@@ -23,17 +33,44 @@ import (
 )
 
 var (
-	configFile = flag.String("config", "config.json", "Path to configuration file")
+	configFile     = flag.String("config", "config.json", "Path to configuration file")
+	logLevel       = flag.String("log-level", "", "Log level (debug, info, warn, error); overrides the config file")
+	validateConfig = flag.Bool("validate-config", false, "Validate the configuration and exit")
 )
 
 func main() {
 	flag.Parse()
 
-	// Load Configuration
-	cfg, err := config.Load(*configFile)
+	// Load Configuration. Without an explicit -config, a missing config.json
+	// selects the defaults; any other load or validation error is fatal.
+	path := *configFile
+	if !flagSet("config") {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			path = ""
+		}
+	}
+	cfg, err := config.Load(path)
+	if err == nil && *logLevel != "" {
+		cfg.Logging.Level = *logLevel
+		err = logging.Validate(cfg.Logging)
+	}
+	var policies *policy.Set
+	if err == nil {
+		policies, err = policy.New(cfg.Policy)
+	}
 	if err != nil {
-		log.Printf("Failed to load config from %s: %v. Using defaults.", *configFile, err)
-		cfg = config.DefaultConfig()
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if *validateConfig {
+		fmt.Println("Configuration is valid")
+		return
+	}
+	if err := logging.Configure(cfg.Logging); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	if path == "" {
+		slog.Info("No configuration file, using defaults", "file", *configFile)
 	}
 
 	// Create context that cancels on SIGINT or SIGTERM
@@ -46,10 +83,24 @@ func main() {
 	fibChan := make(chan api.FIBUpdate, 10000)
 	telemetryChan := make(chan api.AFTUpdate, 10000)
 
+	channelDepth := metrics.Default.GaugeVec("aftsim_channel_depth",
+		"Updates queued in a pipeline channel.", "channel")
+	channelDepth.Func(func() float64 { return float64(len(ribChan)) }, "rib")
+	channelDepth.Func(func() float64 { return float64(len(fibChan)) }, "fib")
+	channelDepth.Func(func() float64 { return float64(len(telemetryChan)) }, "telemetry")
+	channelCapacity := metrics.Default.GaugeVec("aftsim_channel_capacity",
+		"Capacity of a pipeline channel.", "channel")
+	channelCapacity.With("rib").Set(float64(cap(ribChan)))
+	channelCapacity.With("fib").Set(float64(cap(fibChan)))
+	channelCapacity.With("telemetry").Set(float64(cap(telemetryChan)))
+
 	// Initialize Components
-	r := rib.New(fibChan)
+	r := rib.NewSharded(fibChan, cfg.RIB.Shards)
+	r.SetResendUnchanged(cfg.RIB.ResendUnchanged)
+	r.SetPolicies(policies)
+	r.SetAggregates(aggregates(cfg.RIB.Aggregates))
 	f := fib.New(telemetryChan)
-	ts := telemetry.New(f, telemetryChan)
+	ts := telemetry.New(f, telemetryChan, ribChan, cfg.Telemetry)
 	m := mock.New(cfg.Mock)
 
 	g, ctx := errgroup.WithContext(ctx)
@@ -72,14 +123,19 @@ func main() {
 	// 4. gRPC Server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GNMIPort))
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		fatal("Failed to listen", err)
+	}
+	opts, err := security.ServerOptions(cfg.TLS, cfg.Auth)
+	if err != nil {
+		fatal("Failed to configure server security", err)
 	}
-	s := grpc.NewServer()
+	s := grpc.NewServer(opts...)
 	pb.RegisterGNMIServer(s, ts)
+	admin.RegisterAdminServer(s, admin.NewServer(r, f, ts, map[string]admin.ControlledInstaller{mock.Name: m}))
 	reflection.Register(s)
 
 	g.Go(func() error {
-		log.Printf("server listening at %v", lis.Addr())
+		slog.Info("Server listening", "address", lis.Addr())
 		errChan := make(chan error, 1)
 		go func() {
 			errChan <- s.Serve(lis)
@@ -94,17 +150,86 @@ func main() {
 		}
 	})
 
-	// 5. Mock Installer
+	// 5. Dial-out Telemetry
+	if len(cfg.Telemetry.DialOut) > 0 {
+		g.Go(func() error {
+			return ts.RunDialOut(ctx, cfg.Telemetry.DialOut)
+		})
+	}
+
+	// 6. Metrics Endpoint
+	if cfg.MetricsPort > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Default.Handler())
+		mux.Handle("/debug/latency", latency.Handler())
+		hs := &http.Server{Addr: fmt.Sprintf(":%d", cfg.MetricsPort), Handler: mux}
+
+		g.Go(func() error {
+			slog.Info("Metrics listening", "address", hs.Addr)
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- hs.ListenAndServe()
+			}()
+
+			select {
+			case <-ctx.Done():
+				hs.Close()
+				<-errChan
+				return nil
+			case err := <-errChan:
+				return err
+			}
+		})
+	}
+
+	// 7. Mock Installer
+	// ribChan is shared with the gNMI Set handler, so it is never closed here;
+	// the RIB stops when the context is canceled.
 	g.Go(func() error {
-		defer close(ribChan)
 		return m.Run(ctx, ribChan)
 	})
 
-	fmt.Println("Daemon running. Press Ctrl+C to stop.")
+	// 8. Configuration Reload
+	rl := &reloader{path: *configFile, logLevel: *logLevel, cfg: cfg, mock: m, rib: r}
+	g.Go(func() error {
+		return rl.Run(ctx)
+	})
+
+	slog.Info("Daemon running. Press Ctrl+C to stop.")
 	if err := g.Wait(); err != nil {
 		if err != context.Canceled {
-			log.Printf("Daemon error: %v", err)
+			slog.Error("Daemon error", "error", err)
 		}
 	}
-	fmt.Println("Daemon stopped.")
+	slog.Info("Daemon stopped")
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// aggregates converts validated aggregate configurations.
+func aggregates(cfgs []config.AggregateConfig) []rib.Aggregate {
+	var aggs []rib.Aggregate
+	for _, c := range cfgs {
+		a := rib.Aggregate{Prefix: netip.MustParsePrefix(c.Prefix), SummaryOnly: c.SummaryOnly}
+		if c.NextHop != "" {
+			a.NextHop = netip.MustParseAddr(c.NextHop)
+		}
+		aggs = append(aggs, a)
+	}
+	return aggs
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
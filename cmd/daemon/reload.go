@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/installers/mock"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/policy"
+	"github.com/openconfig/aft-simulator/pkg/rib"
+)
+
+// reloadInterval is how often the configuration file is checked for changes.
+const reloadInterval = time.Second
+
+// reloader applies changes of the configuration file to the running daemon
+// when the file is modified or the daemon receives SIGHUP. Installer,
+// logging, policy, rib.resend_unchanged and rib.aggregates settings are
+// applied live; other changes require a restart and are logged as such.
+// The set of installers is fixed: the mock installer is added or removed by
+// enabling or disabling it.
+type reloader struct {
+	path string
+	// logLevel overrides the configured log level when set.
+	logLevel string
+	cfg      *config.Config
+	mock     *mock.MockInstaller
+	rib      *rib.RIB
+}
+
+// Run watches for configuration changes until ctx is canceled.
+func (r *reloader) Run(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	lastMod := modTime(r.path)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			slog.Info("Received SIGHUP, reloading configuration", "file", r.path)
+			r.reload()
+		case <-ticker.C:
+			if mod := modTime(r.path); !mod.Equal(lastMod) {
+				lastMod = mod
+				slog.Info("Configuration file changed, reloading", "file", r.path)
+				r.reload()
+			}
+		}
+	}
+}
+
+// modTime returns the modification time of path, or the zero time if it
+// cannot be read.
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// reload loads and applies the configuration file. An invalid
+// file is reported and leaves the running configuration untouched.
+func (r *reloader) reload() {
+	cfg, err := config.Load(r.path)
+	if err == nil {
+		if r.logLevel != "" {
+			cfg.Logging.Level = r.logLevel
+		}
+		err = logging.Validate(cfg.Logging)
+	}
+	var policies *policy.Set
+	if err == nil {
+		policies, err = policy.New(cfg.Policy)
+	}
+	if err != nil {
+		slog.Error("Rejected configuration", "file", r.path, "error", err)
+		return
+	}
+
+	prev := r.cfg
+	if cfg.Logging != prev.Logging {
+		// Validated above.
+		_ = logging.Configure(cfg.Logging)
+		slog.Info("Applied logging configuration", "level", cfg.Logging.Level, "format", cfg.Logging.Format)
+	}
+	if cfg.Mock != prev.Mock {
+		r.mock.Reconfigure(cfg.Mock)
+	}
+	if cfg.RIB.ResendUnchanged != prev.RIB.ResendUnchanged {
+		r.rib.SetResendUnchanged(cfg.RIB.ResendUnchanged)
+		slog.Info("Applied RIB configuration", "resend_unchanged", cfg.RIB.ResendUnchanged)
+	}
+	if !reflect.DeepEqual(cfg.RIB.Aggregates, prev.RIB.Aggregates) {
+		r.rib.SetAggregates(aggregates(cfg.RIB.Aggregates))
+		slog.Info("Applied RIB aggregates", "aggregates", len(cfg.RIB.Aggregates))
+	}
+	if !reflect.DeepEqual(cfg.Policy, prev.Policy) {
+		r.rib.SetPolicies(policies)
+		slog.Info("Applied route policies", "definitions", len(cfg.Policy.Definitions))
+	}
+
+	restart := []struct {
+		section string
+		changed bool
+	}{
+		{"gnmi_port", cfg.GNMIPort != prev.GNMIPort},
+		{"metrics_port", cfg.MetricsPort != prev.MetricsPort},
+		{"rib.shards", cfg.RIB.Shards != prev.RIB.Shards},
+		{"telemetry", !reflect.DeepEqual(cfg.Telemetry, prev.Telemetry)},
+		{"tls", cfg.TLS != prev.TLS},
+		{"auth", !reflect.DeepEqual(cfg.Auth, prev.Auth)},
+	}
+	for _, c := range restart {
+		if c.changed {
+			slog.Warn("Configuration change requires a restart to take effect", "section", c.section)
+		}
+	}
+	if !reflect.DeepEqual(unhandled(*cfg), unhandled(*prev)) {
+		slog.Warn("Configuration change is not applied until restart", "section", "other")
+	}
+
+	// Record only what is running: settings that need a restart keep their
+	// previous values, so that reverting them is not reported again.
+	running := *prev
+	running.Logging, running.Mock = cfg.Logging, cfg.Mock
+	running.RIB.ResendUnchanged, running.RIB.Aggregates = cfg.RIB.ResendUnchanged, cfg.RIB.Aggregates
+	running.Policy = cfg.Policy
+	r.cfg = &running
+}
+
+// unhandled returns cfg without the settings reload applies or reports, so
+// that a change of any setting added later is not silently ignored.
+func unhandled(cfg config.Config) config.Config {
+	cfg.GNMIPort, cfg.MetricsPort = 0, 0
+	cfg.Mock = config.MockConfig{}
+	cfg.RIB.Shards, cfg.RIB.ResendUnchanged, cfg.RIB.Aggregates = 0, false, nil
+	cfg.Policy = config.PolicyConfig{}
+	cfg.Telemetry = config.TelemetryConfig{}
+	cfg.TLS = config.TLSConfig{}
+	cfg.Auth = config.AuthConfig{}
+	cfg.Logging = config.LogConfig{}
+	return cfg
+}
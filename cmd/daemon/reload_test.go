@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/installers/mock"
+	"github.com/openconfig/aft-simulator/pkg/rib"
+)
+
+// newTestReloader returns a reloader of a configuration file holding
+// initial, and the buffer its log messages are written to.
+func newTestReloader(t *testing.T, initial string) (*reloader, *bytes.Buffer) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, initial)
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	return &reloader{
+		path: path,
+		cfg:  cfg,
+		mock: mock.New(cfg.Mock),
+		rib:  rib.New(make(chan api.FIBUpdate, 10)),
+	}, &logs
+}
+
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestReload_RejectedFile(t *testing.T) {
+	r, logs := newTestReloader(t, `{}`)
+	running := r.cfg
+
+	writeConfig(t, r.path, `{"gnmi_port": "not a port"}`)
+	r.reload()
+	if !strings.Contains(logs.String(), "Rejected configuration") {
+		t.Errorf("Expected the file to be rejected, got logs:\n%s", logs.String())
+	}
+	if r.cfg != running {
+		t.Errorf("Expected the running configuration to be kept")
+	}
+}
+
+func TestReload_LiveSections(t *testing.T) {
+	r, logs := newTestReloader(t, `{}`)
+
+	writeConfig(t, r.path, `{
+		"mock_installer": {"enabled": true, "route_count": 10, "churn_rate": 5},
+		"rib": {"resend_unchanged": true, "aggregates": [{"prefix": "10.0.0.0/8"}]},
+		"policy": {"definitions": {"deny": [{"action": "reject"}]}, "export": "deny"}
+	}`)
+	r.reload()
+
+	for _, msg := range []string{"Applied RIB configuration", "Applied RIB aggregates", "Applied route policies"} {
+		if !strings.Contains(logs.String(), msg) {
+			t.Errorf("Expected %q, got logs:\n%s", msg, logs.String())
+		}
+	}
+	if strings.Contains(logs.String(), "level=WARN") {
+		t.Errorf("Expected no warnings, got logs:\n%s", logs.String())
+	}
+	if r.cfg.Mock.RouteCount != 10 || !r.cfg.RIB.ResendUnchanged || len(r.cfg.RIB.Aggregates) != 1 || r.cfg.Policy.Export != "deny" {
+		t.Errorf("Expected the new settings to be running, got %+v", r.cfg)
+	}
+}
+
+func TestReload_RestartWarnings(t *testing.T) {
+	const initial = `{"gnmi_port": 50100, "telemetry": {"batch_size": 100}}`
+	r, logs := newTestReloader(t, initial)
+
+	writeConfig(t, r.path, `{"gnmi_port": 50200, "telemetry": {"batch_size": 10}}`)
+	r.reload()
+	for _, section := range []string{"gnmi_port", "telemetry"} {
+		if !strings.Contains(logs.String(), "requires a restart to take effect\" section="+section) {
+			t.Errorf("Expected a restart warning for %s, got logs:\n%s", section, logs.String())
+		}
+	}
+	if r.cfg.GNMIPort != 50100 || r.cfg.Telemetry.BatchSize != 100 {
+		t.Errorf("Expected the running settings to be kept, got %+v", r.cfg)
+	}
+
+	// Reverting to the running settings needs no restart.
+	logs.Reset()
+	writeConfig(t, r.path, initial)
+	r.reload()
+	if strings.Contains(logs.String(), "requires a restart") {
+		t.Errorf("Expected no restart warning, got logs:\n%s", logs.String())
+	}
+}
+
+func TestUnhandled(t *testing.T) {
+	a := *config.DefaultConfig()
+	b := a
+	b.GNMIPort, b.MetricsPort = 1, 2
+	b.Mock.RouteCount = 1
+	b.RIB = config.RIBConfig{Shards: 2, ResendUnchanged: true, Aggregates: []config.AggregateConfig{{Prefix: "10.0.0.0/8"}}}
+	b.Policy.Export = "deny"
+	b.Telemetry.BatchSize = 1
+	b.TLS.SelfSigned = true
+	b.Auth.Users = []config.UserConfig{{Username: "admin"}}
+	b.Logging.Level = "debug"
+	// Every setting is applied live or reported as requiring a restart.
+	if !reflect.DeepEqual(unhandled(a), unhandled(b)) {
+		t.Errorf("Expected no unhandled change, got %+v and %+v", unhandled(a), unhandled(b))
+	}
+}
@@ -0,0 +1,64 @@
+// Command latency-report prints the convergence latency of a running
+// simulator, per pipeline stage.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/latency"
+)
+
+var (
+	addr     = flag.String("addr", "localhost:9099", "Address of the simulator metrics endpoint")
+	interval = flag.Duration("interval", 0, "Repeat the report at this interval (0 prints once)")
+)
+
+func main() {
+	flag.Parse()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for {
+		report, err := fetch(client, fmt.Sprintf("http://%s/debug/latency", *addr))
+		if err != nil {
+			log.Fatalf("Failed to fetch latency report: %v", err)
+		}
+		printReport(report)
+		if *interval <= 0 {
+			return
+		}
+		time.Sleep(*interval)
+		fmt.Println()
+	}
+}
+
+func fetch(client *http.Client, url string) ([]latency.StageReport, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	var report []latency.StageReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func printReport(report []latency.StageReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "STAGE\tCOUNT\tP50\tP99\tMAX\t")
+	for _, r := range report {
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%v\t\n", r.Stage, r.Count, r.P50, r.P99, r.Max)
+	}
+	w.Flush()
+}
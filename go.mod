@@ -6,6 +6,8 @@ require (
 	github.com/openconfig/gnmi v0.14.1
 	golang.org/x/sync v0.19.0
 	google.golang.org/grpc v1.78.0
+	google.golang.org/protobuf v1.36.10
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -13,5 +15,4 @@ require (
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251029180050-ab9386a59fda // indirect
-	google.golang.org/protobuf v1.36.10 // indirect
 )
@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/fib"
+	"github.com/openconfig/aft-simulator/pkg/rib"
+	"github.com/openconfig/aft-simulator/pkg/telemetry"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ControlledInstaller is a route installer that can be inspected and paused.
+type ControlledInstaller interface {
+	Status() api.InstallerStatus
+	Pause()
+	Resume()
+}
+
+// Server implements AdminServer on top of the daemon's components.
+type Server struct {
+	rib        *rib.RIB
+	fib        *fib.FIB
+	telemetry  *telemetry.GNMIServer
+	installers map[string]ControlledInstaller
+}
+
+// NewServer creates an admin server. installers maps installer names, as
+// used by PauseInstaller and ResumeInstaller, to installers.
+func NewServer(r *rib.RIB, f *fib.FIB, ts *telemetry.GNMIServer, installers map[string]ControlledInstaller) *Server {
+	return &Server{rib: r, fib: f, telemetry: ts, installers: installers}
+}
+
+// GetRIB dumps the candidate routes and best path of a prefix.
+func (s *Server) GetRIB(_ context.Context, req *GetRIBRequest) (*GetRIBResponse, error) {
+	if !req.Prefix.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, "prefix is required")
+	}
+	state, ok := s.rib.Lookup(req.Prefix)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no route for %s", req.Prefix)
+	}
+	return &GetRIBResponse{State: state}, nil
+}
+
+// ListFIB lists the installed prefixes and MPLS label entries.
+func (s *Server) ListFIB(context.Context, *ListFIBRequest) (*ListFIBResponse, error) {
+	return &ListFIBResponse{Entries: s.fib.Entries(), LabelEntries: s.fib.LabelEntries()}, nil
+}
+
+// ListNextHopGroups lists the next-hop groups and next hops with their
+// reference counts.
+func (s *Server) ListNextHopGroups(context.Context, *ListNextHopGroupsRequest) (*ListNextHopGroupsResponse, error) {
+	return &ListNextHopGroupsResponse{Groups: s.fib.NextHopGroups(), NextHops: s.fib.NextHops()}, nil
+}
+
+// ListSubscribers lists the telemetry receivers and their queue depths.
+func (s *Server) ListSubscribers(context.Context, *ListSubscribersRequest) (*ListSubscribersResponse, error) {
+	return &ListSubscribersResponse{Subscribers: s.telemetry.Subscribers()}, nil
+}
+
+// ListInstallers lists the route installers and their status.
+func (s *Server) ListInstallers(context.Context, *ListInstallersRequest) (*ListInstallersResponse, error) {
+	resp := &ListInstallersResponse{}
+	for name, inst := range s.installers {
+		resp.Installers = append(resp.Installers, Installer{Name: name, Status: inst.Status()})
+	}
+	slices.SortFunc(resp.Installers, func(a, b Installer) int { return strings.Compare(a.Name, b.Name) })
+	return resp, nil
+}
+
+// PauseInstaller stops an installer from injecting route churn.
+func (s *Server) PauseInstaller(_ context.Context, req *InstallerRequest) (*InstallerResponse, error) {
+	inst, err := s.installer(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	inst.Pause()
+	return &InstallerResponse{Installer: Installer{Name: req.Name, Status: inst.Status()}}, nil
+}
+
+// ResumeInstaller resumes a paused installer.
+func (s *Server) ResumeInstaller(_ context.Context, req *InstallerRequest) (*InstallerResponse, error) {
+	inst, err := s.installer(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	inst.Resume()
+	return &InstallerResponse{Installer: Installer{Name: req.Name, Status: inst.Status()}}, nil
+}
+
+func (s *Server) installer(name string) (ControlledInstaller, error) {
+	inst, ok := s.installers[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown installer %q", name)
+	}
+	return inst, nil
+}
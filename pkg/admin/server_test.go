@@ -0,0 +1,122 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/fib"
+	"github.com/openconfig/aft-simulator/pkg/rib"
+	"github.com/openconfig/aft-simulator/pkg/telemetry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testInstaller struct {
+	paused bool
+}
+
+func (i *testInstaller) Status() api.InstallerStatus {
+	return api.InstallerStatus{Protocol: api.ProtocolMock, Enabled: true, Paused: i.paused}
+}
+func (i *testInstaller) Pause()  { i.paused = true }
+func (i *testInstaller) Resume() { i.paused = false }
+
+func TestServer(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	telemetryChan := make(chan api.AFTUpdate, 10)
+	r := rib.New(fibChan)
+	f := fib.New(telemetryChan)
+	ts := telemetry.New(f, telemetryChan, nil, config.TelemetryConfig{})
+
+	prefix := netip.MustParsePrefix("10.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh, AdminDist: 1})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.2.1"), AdminDist: 110})
+	f.Update(<-fibChan)
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	RegisterAdminServer(gs, NewServer(r, f, ts, map[string]ControlledInstaller{"mock": &testInstaller{}}))
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	c := NewClient(conn)
+	ctx := context.Background()
+
+	ribResp, err := c.GetRIB(ctx, &GetRIBRequest{Prefix: prefix})
+	if err != nil {
+		t.Fatalf("GetRIB failed: %v", err)
+	}
+	if len(ribResp.State.Candidates) != 2 || ribResp.State.Best == nil || ribResp.State.Best.Protocol != api.ProtocolStatic {
+		t.Errorf("Unexpected RIB state %+v", ribResp.State)
+	}
+	if _, err := c.GetRIB(ctx, &GetRIBRequest{Prefix: netip.MustParsePrefix("10.9.0.0/24")}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for unknown prefix, got %v", err)
+	}
+
+	fibResp, err := c.ListFIB(ctx, &ListFIBRequest{})
+	if err != nil {
+		t.Fatalf("ListFIB failed: %v", err)
+	}
+	if len(fibResp.Entries) != 1 || fibResp.Entries[0].Prefix != prefix || fibResp.Entries[0].NextHop != nh {
+		t.Errorf("Unexpected FIB entries %+v", fibResp.Entries)
+	}
+
+	nhgResp, err := c.ListNextHopGroups(ctx, &ListNextHopGroupsRequest{})
+	if err != nil {
+		t.Fatalf("ListNextHopGroups failed: %v", err)
+	}
+	if len(nhgResp.Groups) != 1 || nhgResp.Groups[0].RefCount != 1 || len(nhgResp.NextHops) != 1 {
+		t.Errorf("Unexpected next-hop groups %+v", nhgResp)
+	}
+
+	subResp, err := c.ListSubscribers(ctx, &ListSubscribersRequest{})
+	if err != nil {
+		t.Fatalf("ListSubscribers failed: %v", err)
+	}
+	if len(subResp.Subscribers) != 0 {
+		t.Errorf("Expected no subscribers, got %+v", subResp.Subscribers)
+	}
+
+	instResp, err := c.PauseInstaller(ctx, &InstallerRequest{Name: "mock"})
+	if err != nil {
+		t.Fatalf("PauseInstaller failed: %v", err)
+	}
+	if !instResp.Installer.Status.Paused {
+		t.Errorf("Expected paused installer, got %+v", instResp.Installer)
+	}
+	listResp, err := c.ListInstallers(ctx, &ListInstallersRequest{})
+	if err != nil {
+		t.Fatalf("ListInstallers failed: %v", err)
+	}
+	if len(listResp.Installers) != 1 || listResp.Installers[0].Name != "mock" || !listResp.Installers[0].Status.Paused {
+		t.Errorf("Unexpected installers %+v", listResp.Installers)
+	}
+	if _, err := c.ResumeInstaller(ctx, &InstallerRequest{Name: "bgp"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for unknown installer, got %v", err)
+	}
+}
+
+func TestCodec_KeepsJSON(t *testing.T) {
+	if _, ok := encoding.GetCodec("json").(jsonCodec); ok {
+		t.Errorf("Expected the admin codec not to replace the json codec")
+	}
+	if _, ok := encoding.GetCodec(codecName).(jsonCodec); !ok {
+		t.Errorf("Expected the admin codec registered as %q", codecName)
+	}
+}
@@ -0,0 +1,218 @@
+// Package admin defines the gRPC service used to inspect and control a
+// running simulator.
+//
+// Messages are Go structs exchanged with a JSON codec rather than protobuf,
+// so clients must use this package (or any gRPC client sending the
+// "aftsim-json" content subtype). The service is equivalent to:
+//
+//	service Admin {
+//	  rpc GetRIB(GetRIBRequest) returns (GetRIBResponse);
+//	  rpc ListFIB(ListFIBRequest) returns (ListFIBResponse);
+//	  rpc ListNextHopGroups(ListNextHopGroupsRequest) returns (ListNextHopGroupsResponse);
+//	  rpc ListSubscribers(ListSubscribersRequest) returns (ListSubscribersResponse);
+//	  rpc ListInstallers(ListInstallersRequest) returns (ListInstallersResponse);
+//	  rpc PauseInstaller(InstallerRequest) returns (InstallerResponse);
+//	  rpc ResumeInstaller(InstallerRequest) returns (InstallerResponse);
+//	}
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/fib"
+	"github.com/openconfig/aft-simulator/pkg/rib"
+	"github.com/openconfig/aft-simulator/pkg/telemetry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// ServiceName is the fully qualified name of the admin service.
+const ServiceName = "aftsim.admin.Admin"
+
+// GetRIBRequest selects the prefix to dump.
+type GetRIBRequest struct {
+	Prefix netip.Prefix
+}
+
+// GetRIBResponse holds every candidate route of the prefix and the winner.
+type GetRIBResponse struct {
+	State rib.PrefixState
+}
+
+// ListFIBRequest requests the installed prefixes and MPLS label entries.
+type ListFIBRequest struct{}
+
+// ListFIBResponse holds the installed prefixes and MPLS label entries.
+type ListFIBResponse struct {
+	Entries      []fib.Entry
+	LabelEntries []fib.LabelEntry
+}
+
+// ListNextHopGroupsRequest requests the next-hop groups and next hops.
+type ListNextHopGroupsRequest struct{}
+
+// ListNextHopGroupsResponse holds the next-hop groups and next hops with
+// their reference counts.
+type ListNextHopGroupsResponse struct {
+	Groups   []fib.NextHopGroup
+	NextHops []fib.NextHop
+}
+
+// ListSubscribersRequest requests the telemetry receivers.
+type ListSubscribersRequest struct{}
+
+// ListSubscribersResponse holds the active telemetry receivers.
+type ListSubscribersResponse struct {
+	Subscribers []telemetry.SubscriberInfo
+}
+
+// ListInstallersRequest requests the route installers.
+type ListInstallersRequest struct{}
+
+// Installer is a named route installer and its status.
+type Installer struct {
+	Name   string
+	Status api.InstallerStatus
+}
+
+// ListInstallersResponse holds the route installers, sorted by name.
+type ListInstallersResponse struct {
+	Installers []Installer
+}
+
+// InstallerRequest selects an installer by name.
+type InstallerRequest struct {
+	Name string
+}
+
+// InstallerResponse holds the status of an installer after a change.
+type InstallerResponse struct {
+	Installer Installer
+}
+
+// AdminServer is implemented by the admin service.
+type AdminServer interface {
+	GetRIB(context.Context, *GetRIBRequest) (*GetRIBResponse, error)
+	ListFIB(context.Context, *ListFIBRequest) (*ListFIBResponse, error)
+	ListNextHopGroups(context.Context, *ListNextHopGroupsRequest) (*ListNextHopGroupsResponse, error)
+	ListSubscribers(context.Context, *ListSubscribersRequest) (*ListSubscribersResponse, error)
+	ListInstallers(context.Context, *ListInstallersRequest) (*ListInstallersResponse, error)
+	PauseInstaller(context.Context, *InstallerRequest) (*InstallerResponse, error)
+	ResumeInstaller(context.Context, *InstallerRequest) (*InstallerResponse, error)
+}
+
+// ServiceDesc describes the admin service for grpc.Server registration.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		method("GetRIB", AdminServer.GetRIB),
+		method("ListFIB", AdminServer.ListFIB),
+		method("ListNextHopGroups", AdminServer.ListNextHopGroups),
+		method("ListSubscribers", AdminServer.ListSubscribers),
+		method("ListInstallers", AdminServer.ListInstallers),
+		method("PauseInstaller", AdminServer.PauseInstaller),
+		method("ResumeInstaller", AdminServer.ResumeInstaller),
+	},
+}
+
+// RegisterAdminServer registers srv as the admin service on s.
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+// method describes the unary RPC name implemented by call.
+func method[Req, Resp any](name string, call func(AdminServer, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(AdminServer), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}
+			return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(AdminServer), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+// Client calls the admin service.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient creates a client using conn.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// invoke calls the unary RPC name with the JSON codec.
+func invoke[Resp any](ctx context.Context, c *Client, name string, req any, opts []grpc.CallOption) (*Resp, error) {
+	resp := new(Resp)
+	opts = append(opts, grpc.CallContentSubtype(codecName))
+	if err := c.conn.Invoke(ctx, "/"+ServiceName+"/"+name, req, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetRIB dumps the RIB state of a prefix.
+func (c *Client) GetRIB(ctx context.Context, req *GetRIBRequest, opts ...grpc.CallOption) (*GetRIBResponse, error) {
+	return invoke[GetRIBResponse](ctx, c, "GetRIB", req, opts)
+}
+
+// ListFIB lists the installed prefixes.
+func (c *Client) ListFIB(ctx context.Context, req *ListFIBRequest, opts ...grpc.CallOption) (*ListFIBResponse, error) {
+	return invoke[ListFIBResponse](ctx, c, "ListFIB", req, opts)
+}
+
+// ListNextHopGroups lists the next-hop groups and next hops.
+func (c *Client) ListNextHopGroups(ctx context.Context, req *ListNextHopGroupsRequest, opts ...grpc.CallOption) (*ListNextHopGroupsResponse, error) {
+	return invoke[ListNextHopGroupsResponse](ctx, c, "ListNextHopGroups", req, opts)
+}
+
+// ListSubscribers lists the telemetry receivers.
+func (c *Client) ListSubscribers(ctx context.Context, req *ListSubscribersRequest, opts ...grpc.CallOption) (*ListSubscribersResponse, error) {
+	return invoke[ListSubscribersResponse](ctx, c, "ListSubscribers", req, opts)
+}
+
+// ListInstallers lists the route installers.
+func (c *Client) ListInstallers(ctx context.Context, req *ListInstallersRequest, opts ...grpc.CallOption) (*ListInstallersResponse, error) {
+	return invoke[ListInstallersResponse](ctx, c, "ListInstallers", req, opts)
+}
+
+// PauseInstaller pauses a route installer.
+func (c *Client) PauseInstaller(ctx context.Context, req *InstallerRequest, opts ...grpc.CallOption) (*InstallerResponse, error) {
+	return invoke[InstallerResponse](ctx, c, "PauseInstaller", req, opts)
+}
+
+// ResumeInstaller resumes a paused route installer.
+func (c *Client) ResumeInstaller(ctx context.Context, req *InstallerRequest, opts ...grpc.CallOption) (*InstallerResponse, error) {
+	return invoke[InstallerResponse](ctx, c, "ResumeInstaller", req, opts)
+}
+
+// codecName is the content subtype of admin messages. It is specific to
+// this package so that registering the codec does not replace the "json"
+// codec other services of the process may rely on. The admin service shares
+// its gRPC server with gNMI, so the codec is selected by content subtype
+// rather than forced on the server.
+const codecName = "aftsim-json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes admin messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return codecName }
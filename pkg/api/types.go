@@ -1,7 +1,11 @@
 package api
 
 import (
+	"fmt"
 	"net/netip"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ActionType defines the type of update (Add or Delete).
@@ -12,24 +16,190 @@ const (
 	Add ActionType = "ADD"
 	// Delete indicates a route removal.
 	Delete ActionType = "DELETE"
+	// NextHopDown marks every next hop contained in Prefix or, if Interface
+	// is set, every NextHopInterface next hop of that interface as
+	// unreachable. Routes resolving via such next hops are withdrawn from
+	// the FIB.
+	NextHopDown ActionType = "NEXT_HOP_DOWN"
+	// NextHopUp clears a previous NextHopDown for the same Prefix or
+	// Interface.
+	NextHopUp ActionType = "NEXT_HOP_UP"
 )
 
 // RIBUpdate represents an update from an installer to the RIB.
 type RIBUpdate struct {
-	Action    ActionType
-	Protocol  string // e.g., ProtocolStatic, ProtocolBGP
-	Prefix    netip.Prefix
-	NextHop   netip.Addr
-	Metric    uint32
-	AdminDist uint8
+	Action   ActionType
+	Protocol string // e.g., ProtocolStatic, ProtocolBGP
+	// Source identifies the protocol instance or peer the route was
+	// learned from, e.g. a BGP neighbor. PathID distinguishes the paths of
+	// one source, as with BGP add-path. A route is identified by its
+	// Protocol, Source and PathID, so a protocol can contribute several
+	// paths to a prefix; a Delete withdraws only the matching path.
+	Source string
+	PathID uint32
+	Prefix netip.Prefix
+	// Label, if non-zero, makes the update an MPLS label entry for this
+	// incoming label instead of a route to Prefix. Label entries are
+	// identified like routes and use the same next hops.
+	Label   uint32
+	NextHop netip.Addr
+	// NextHopType is the forwarding action of the route. NextHop is unset
+	// for types other than NextHopIP.
+	NextHopType NextHopType
+	// Interface is the egress interface of a NextHopInterface route.
+	Interface string
+	// PushedLabels is the label stack the next hop pushes. A label entry
+	// always pops its incoming label: with PushedLabels it swaps the label,
+	// without it pops it.
+	PushedLabels LabelStack
+	Metric       uint32
+	AdminDist    uint8
+	// Tag is an administrative route tag that policies can match on.
+	Tag uint32
+	// Installer names the installer that sent the update, e.g. "mock". It
+	// selects the import policy applied to the route.
+	Installer string
+	// BGP holds the path attributes of a ProtocolBGP route. Nil selects
+	// the default attributes.
+	BGP *BGPAttributes
+	// Timestamp is when the update was ingested. The RIB stamps updates
+	// that arrive without one.
+	Timestamp time.Time
+}
+
+// NextHopType is the forwarding action of a next hop.
+type NextHopType string
+
+const (
+	// NextHopIP forwards to the IP address of the next hop. It is the zero
+	// value.
+	NextHopIP NextHopType = ""
+	// NextHopDrop discards the traffic, like a route to null0.
+	NextHopDrop NextHopType = "DROP"
+	// NextHopReceive punts the traffic to the local CPU.
+	NextHopReceive NextHopType = "RECEIVE"
+	// NextHopInterface forwards out of an interface, without a next-hop
+	// address, as for a directly connected subnet.
+	NextHopInterface NextHopType = "INTERFACE"
+)
+
+// NextHopString formats a next hop of type typ: the address addr of an IP
+// next hop, the interface iface of an interface next hop, otherwise the
+// type, followed by the labels it pushes, e.g. "192.0.2.1 push 16001/16002".
+func NextHopString(typ NextHopType, addr netip.Addr, iface string, pushed LabelStack) string {
+	var s string
+	switch typ {
+	case NextHopIP:
+		s = addr.String()
+	case NextHopInterface:
+		s = iface
+	default:
+		s = string(typ)
+	}
+	if len(pushed) > 0 {
+		s += " push " + pushed.String()
+	}
+	return s
+}
+
+// MPLS label values.
+const (
+	// MinLabel is the lowest label that is not reserved, and so the lowest
+	// incoming label of a label entry.
+	MinLabel = 16
+	// MaxLabel is the highest 20-bit label.
+	MaxLabel = 1<<20 - 1
+)
+
+// LabelStack is a stack of MPLS labels, outermost label first.
+type LabelStack []uint32
+
+// String formats the stack as its labels separated by slashes, e.g.
+// "16001/16002".
+func (l LabelStack) String() string {
+	labels := make([]string, len(l))
+	for i, label := range l {
+		labels[i] = strconv.FormatUint(uint64(label), 10)
+	}
+	return strings.Join(labels, "/")
+}
+
+// ParseLabelStack parses a label stack formatted by LabelStack.String. The
+// empty string is the empty stack.
+func ParseLabelStack(s string) (LabelStack, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var l LabelStack
+	for _, f := range strings.Split(s, "/") {
+		label, err := strconv.ParseUint(f, 10, 32)
+		if err != nil || label > MaxLabel {
+			return nil, fmt.Errorf("invalid MPLS label %q", f)
+		}
+		l = append(l, uint32(label))
+	}
+	return l, nil
+}
+
+// BGPOrigin is the ORIGIN path attribute.
+type BGPOrigin uint8
+
+// BGP origins, in order of preference.
+const (
+	OriginIGP BGPOrigin = iota
+	OriginEGP
+	OriginIncomplete
+)
+
+func (o BGPOrigin) String() string {
+	switch o {
+	case OriginIGP:
+		return "IGP"
+	case OriginEGP:
+		return "EGP"
+	case OriginIncomplete:
+		return "INCOMPLETE"
+	}
+	return fmt.Sprintf("BGPOrigin(%d)", uint8(o))
+}
+
+// DefaultLocalPref is the LOCAL_PREF of paths without BGP attributes.
+const DefaultLocalPref = 100
+
+// BGPAttributes are the path attributes of a BGP route that take part in
+// best-path selection. The metric of the route is its IGP cost.
+type BGPAttributes struct {
+	LocalPref uint32
+	// ASPath lists the AS numbers of the path, nearest AS first.
+	ASPath []uint32
+	Origin BGPOrigin
+	MED    uint32
+	// Communities are carried but not used for selection, e.g. "65000:100".
+	Communities []string
+	// EBGP reports whether the path was learned from an external peer.
+	EBGP bool
+	// OriginatorID and ClusterList are set on paths reflected by a route
+	// reflector.
+	OriginatorID netip.Addr
+	ClusterList  []netip.Addr
+	// Neighbor is the address of the peer the path was learned from.
+	Neighbor netip.Addr
 }
 
 // FIBUpdate represents an update from the RIB to the FIB.
 // It indicates a change in the best path for a prefix.
 type FIBUpdate struct {
-	Action  ActionType
-	Prefix  netip.Prefix
-	NextHop netip.Addr
+	Action ActionType
+	Prefix netip.Prefix
+	// Label, if non-zero, selects the MPLS label entry of this incoming
+	// label instead of Prefix.
+	Label        uint32
+	NextHop      netip.Addr
+	NextHopType  NextHopType
+	Interface    string
+	PushedLabels LabelStack
+	// Timestamp is the time of the RIBUpdate that caused this change.
+	Timestamp time.Time
 }
 
 // AFTEntryType defines the type of AFT entry being updated.
@@ -42,6 +212,8 @@ const (
 	AFTEntryNextHopGroup AFTEntryType = "NEXT_HOP_GROUP"
 	// AFTEntryNextHop indicates a next-hop entry.
 	AFTEntryNextHop AFTEntryType = "NEXT_HOP"
+	// AFTEntryLabel indicates an MPLS label entry.
+	AFTEntryLabel AFTEntryType = "LABEL"
 )
 
 // AFTUpdate represents an update from the FIB to the Telemetry server.
@@ -50,8 +222,22 @@ type AFTUpdate struct {
 	Action       ActionType
 	EntryType    AFTEntryType
 	Prefix       netip.Prefix // Used if EntryType == AFTEntryPrefix
-	NextHopGroup uint64       // Used if EntryType == AFTEntryPrefix or AFTEntryNextHopGroup
+	Label        uint32       // Used if EntryType == AFTEntryLabel
+	NextHopGroup uint64       // Used if EntryType == AFTEntryPrefix, AFTEntryLabel or AFTEntryNextHopGroup
 	NextHop      netip.Addr   // Used if EntryType == AFTEntryNextHopGroup or AFTEntryNextHop
+	NextHopType  NextHopType  // Used with NextHop
+	Interface    string       // Used with NextHop if NextHopType == NextHopInterface
+	PushedLabels LabelStack   // Used with NextHop
+	// Seq is a strictly increasing sequence number assigned by the FIB.
+	// Snapshot entries carry the sequence number the snapshot is current to.
+	Seq uint64
+	// Timestamp is when the entry last changed, carried from the RIBUpdate
+	// that caused the change.
+	Timestamp time.Time
+	// EventTime is the time of the RIBUpdate that caused this update, used
+	// to measure latency. It differs from Timestamp when an unchanged entry
+	// is refreshed, and is zero for snapshot entries.
+	EventTime time.Time
 }
 
 // RouteInstaller is the interface for modules that inject routes into the RIB.
@@ -62,12 +248,24 @@ type RouteInstaller interface {
 	Stop() error
 }
 
+// InstallerStatus describes the state of a route installer.
+type InstallerStatus struct {
+	// Protocol is the protocol of the routes the installer injects.
+	Protocol  string
+	Enabled   bool
+	Paused    bool
+	Routes    int
+	ChurnRate int // Updates per second
+}
+
 // Common Protocol Constants
 const (
 	ProtocolStatic = "STATIC"
 	ProtocolOSPF   = "OSPF"
 	ProtocolMock   = "MOCK"
 	ProtocolBGP    = "BGP"
+	// ProtocolAggregate marks aggregate routes originated by the RIB.
+	ProtocolAggregate = "AGGREGATE"
 )
 
 // Common Network Instance Constants
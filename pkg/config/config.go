@@ -1,14 +1,31 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application configuration.
 type Config struct {
-	GNMIPort int `json:"gnmi_port"`
-	Mock     MockConfig `json:"mock_installer"`
+	GNMIPort    int             `json:"gnmi_port"`
+	MetricsPort int             `json:"metrics_port"` // 0 disables the metrics endpoint
+	Mock        MockConfig      `json:"mock_installer"`
+	RIB         RIBConfig       `json:"rib"`
+	Policy      PolicyConfig    `json:"policy"`
+	Telemetry   TelemetryConfig `json:"telemetry"`
+	TLS         TLSConfig       `json:"tls"`
+	Auth        AuthConfig      `json:"auth"`
+	Logging     LogConfig       `json:"logging"`
 }
 
 // MockConfig holds configuration for the mock route installer.
@@ -18,29 +35,270 @@ type MockConfig struct {
 	ChurnRate  int  `json:"churn_rate"` // Updates per second
 }
 
-// Load reads configuration from a file.
+// RIBConfig holds configuration for the RIB.
+type RIBConfig struct {
+	// Shards is the number of partitions of the RIB processed in parallel.
+	// Zero uses one shard per CPU.
+	Shards int `json:"shards"`
+	// ResendUnchanged sends the best path of a prefix to the FIB after
+	// every change, even if the selected next hop did not change.
+	ResendUnchanged bool `json:"resend_unchanged"`
+	// Aggregates are summary routes originated while a more-specific route
+	// exists.
+	Aggregates []AggregateConfig `json:"aggregates"`
+}
+
+// AggregateConfig describes an aggregate route.
+type AggregateConfig struct {
+	Prefix string `json:"prefix"`
+	// NextHop is the next hop of the aggregate route. Empty discards the
+	// traffic.
+	NextHop string `json:"next_hop"`
+	// SummaryOnly keeps the more-specific routes out of the FIB while the
+	// aggregate is originated.
+	SummaryOnly bool `json:"summary_only"`
+}
+
+// PolicyConfig defines route policies and where the RIB applies them.
+type PolicyConfig struct {
+	// PrefixLists maps names to lists of prefix ranges, e.g. "10.0.0.0/8"
+	// (that prefix only), "10.0.0.0/8 le 24" or "10.0.0.0/8 ge 16 le 24"
+	// (more-specifics of 10.0.0.0/8 with a length in the range).
+	PrefixLists map[string][]string `json:"prefix_lists"`
+	// Definitions maps policy names to their statements, which are
+	// evaluated in order until one matches.
+	Definitions map[string][]PolicyStatement `json:"definitions"`
+	// Import maps installer names ("mock", "gnmi") to the policy applied to
+	// their routes as they enter the RIB.
+	Import map[string]string `json:"import"`
+	// Export names the policy applied to best paths sent to the FIB.
+	Export string `json:"export"`
+}
+
+// PolicyStatement is a statement of a route policy. A route matches if it
+// satisfies every condition set; the statement then modifies the route and
+// accepts or rejects it.
+type PolicyStatement struct {
+	PrefixList string   `json:"prefix_list"`
+	Protocols  []string `json:"protocols"`
+	Metric     *uint32  `json:"metric"`
+	Tag        *uint32  `json:"tag"`
+	// Action is "accept" (default) or "reject".
+	Action           string  `json:"action"`
+	SetMetric        *uint32 `json:"set_metric"`
+	SetAdminDistance *uint8  `json:"set_admin_distance"`
+	SetNextHop       string  `json:"set_next_hop"`
+}
+
+// TelemetryConfig holds configuration for the gNMI telemetry server.
+type TelemetryConfig struct {
+	// BatchSize is the maximum number of AFT entries coalesced into a single
+	// notification. Values of 1 or less disable batching.
+	BatchSize int `json:"batch_size"`
+	// BatchLatencyMs is the longest time an update may wait in a batch
+	// before the batch is sent. Zero sends every update immediately.
+	BatchLatencyMs int `json:"batch_latency_ms"`
+	// SubscriberQueueSize is the number of updates buffered per subscriber.
+	SubscriberQueueSize int `json:"subscriber_queue_size"`
+	// SlowSubscriberPolicy selects what happens when a subscriber's queue is
+	// full: "block", "disconnect" or "resync".
+	SlowSubscriberPolicy string `json:"slow_subscriber_policy"`
+	// BlockTimeoutMs bounds how long the "block" policy waits for queue
+	// space before disconnecting the subscriber.
+	BlockTimeoutMs int `json:"block_timeout_ms"`
+	// DialOut lists collectors the daemon connects to and streams AFT
+	// telemetry to.
+	DialOut []DialOutConfig `json:"dial_out"`
+}
+
+// DialOutConfig describes a dial-out telemetry destination.
+type DialOutConfig struct {
+	Address string `json:"address"`
+	// Paths restricts the exported AFT entries. Empty exports everything.
+	Paths []string `json:"paths"`
+	// Encoding is "proto" (default), "json" or "json_ietf".
+	Encoding string `json:"encoding"`
+	// TLS enables TLS towards the collector, verified against CAFile or
+	// the system roots unless SkipVerify is set.
+	TLS        bool   `json:"tls"`
+	CAFile     string `json:"ca_file"`
+	SkipVerify bool   `json:"skip_verify"`
+}
+
+// TLSConfig holds the transport security settings of the gRPC server.
+// TLS is enabled if CertFile/KeyFile are set or SelfSigned is true.
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// SelfSigned generates an ephemeral self-signed certificate at startup
+	// when no CertFile/KeyFile are configured.
+	SelfSigned bool `json:"self_signed"`
+	// CAFile is a PEM bundle used to verify client certificates.
+	CAFile string `json:"ca_file"`
+	// ClientAuth requires clients to present a certificate signed by CAFile (mTLS).
+	ClientAuth bool `json:"client_auth"`
+}
+
+// AuthConfig holds username/password authentication for gRPC requests.
+// Authentication is enabled if any users are configured.
+type AuthConfig struct {
+	Users []UserConfig `json:"users"`
+}
+
+// UserConfig describes a user allowed to call the gRPC services.
+type UserConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Allow lists the RPCs the user may call, e.g. "subscribe" or "set".
+	// "*" allows every RPC.
+	Allow []string `json:"allow"`
+}
+
+// LogConfig holds the logging settings.
+type LogConfig struct {
+	// Level is "debug", "info" (default), "warn" or "error".
+	Level string `json:"level"`
+	// Format is "text" (default) or "json".
+	Format string `json:"format"`
+	// RouteSampleRate traces every Nth route event at debug level. Values
+	// of 1 or less trace every event.
+	RouteSampleRate int `json:"route_sample_rate"`
+}
+
+// Load reads the configuration from a JSON or YAML file (selected by the
+// .yaml/.yml extension). Fields missing from the file keep their default
+// values, unknown fields are rejected, and AFTSIM_* environment variables
+// override file values (see applyEnv). The result is validated. An empty
+// path loads the defaults with environment overrides.
 func Load(path string) (*Config, error) {
-	f, err := os.Open(path)
-	if err != nil {
+	cfg := DefaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+			if data, err = yamlToJSON(data); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		if err := decodeStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return cfg, nil
+}
+
+// decodeStrict decodes a single JSON object from data into cfg, rejecting
+// unknown fields.
+func decodeStrict(data []byte, cfg *Config) error {
+	// Report unknown fields with their full path first; the decoder only
+	// names the field itself.
+	var raw any
+	if err := json.Unmarshal(data, &raw); err == nil {
+		if err := checkFields(raw, reflect.TypeOf(*cfg), ""); err != nil {
+			return err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("%s: cannot use %s as %s", typeErr.Field, typeErr.Value, typeErr.Type)
+		}
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the configuration object")
+	}
+	return nil
+}
 
-	var cfg Config
-	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+// checkFields reports the first field of raw, in sorted order, that has no
+// counterpart in t.
+func checkFields(raw any, t reflect.Type, path string) error {
+	switch v := raw.(type) {
+	case map[string]any:
+		if t.Kind() == reflect.Map {
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				if err := checkFields(v[k], t.Elem(), path+k+"."); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			fields[tag] = t.Field(i).Type
+		}
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			ft, ok := fields[k]
+			if !ok {
+				return fmt.Errorf("unknown field %q", path+k)
+			}
+			if err := checkFields(v[k], ft, path+k+"."); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for i, e := range v {
+			if err := checkFields(e, t.Elem(), fmt.Sprintf("%s[%d].", strings.TrimSuffix(path, "."), i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlToJSON converts a YAML document to JSON so that YAML files are decoded
+// with the same field names and strictness as JSON files.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
 		return nil, err
 	}
-	return &cfg, nil
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
 }
 
 // DefaultConfig returns a default configuration.
 func DefaultConfig() *Config {
 	return &Config{
-		GNMIPort: 50099,
+		GNMIPort:    50099,
+		MetricsPort: 9099,
 		Mock: MockConfig{
 			Enabled:    true,
 			RouteCount: 1000,
 			ChurnRate:  100,
 		},
+		Telemetry: TelemetryConfig{
+			BatchSize:            100,
+			BatchLatencyMs:       10,
+			SubscriberQueueSize:  100,
+			SlowSubscriberPolicy: "resync",
+			BlockTimeoutMs:       1000,
+		},
+		Logging: LogConfig{
+			Level:           "info",
+			Format:          "text",
+			RouteSampleRate: 100,
+		},
 	}
 }
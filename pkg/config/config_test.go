@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoad_MergesDefaults(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.json", `{"mock_installer": {"route_count": 10}}`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	def := DefaultConfig()
+	if cfg.Mock.RouteCount != 10 {
+		t.Errorf("Expected route_count 10, got %d", cfg.Mock.RouteCount)
+	}
+	if cfg.Mock.ChurnRate != def.Mock.ChurnRate || !cfg.Mock.Enabled || cfg.GNMIPort != def.GNMIPort {
+		t.Errorf("Expected defaults for unset fields, got %+v", cfg)
+	}
+}
+
+func TestLoad_YAML(t *testing.T) {
+	cfg, err := Load(writeFile(t, "config.yaml", "gnmi_port: 50200\ntelemetry:\n  batch_size: 5\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.GNMIPort != 50200 || cfg.Telemetry.BatchSize != 5 {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"config.json", `{"telemetry": {"batch_sise": 1}}`, `unknown field "telemetry.batch_sise"`},
+		{"config.yaml", "auth:\n  users:\n    - username: a\n      pasword: b\n", `unknown field "auth.users[0].pasword"`},
+		{"config.json", `{"gnmi_port": "x"}`, "gnmi_port: cannot use string as int"},
+		{"config.json", `{"gnmi_port": 0}`, "gnmi_port: must be between 1 and 65535"},
+		{"config.json", `{"mock_installer": {"route_count": -1}}`, "mock_installer.route_count: must be between 0 and 65536"},
+		{"config.json", `{"mock_installer": {"churn_rate": 0}}`, "mock_installer.churn_rate: must be greater than 0"},
+		{"config.json", `{"rib": {"shards": -1}}`, "rib.shards: must not be negative"},
+		{"config.json", `{"rib": {"aggregates": [{"prefix": "10.0.0.0"}]}}`, `rib.aggregates[0].prefix: invalid prefix "10.0.0.0"`},
+		{"config.json", `{"rib": {"aggregates": [{"prefix": "10.0.0.0/8"}, {"prefix": "10.1.0.0/8"}]}}`,
+			"rib.aggregates[1].prefix: duplicate aggregate 10.1.0.0/8"},
+		{"config.json", `{"rib": {"aggregates": [{"prefix": "10.0.0.0/8", "next_hop": "x"}]}}`, `rib.aggregates[0].next_hop: invalid address "x"`},
+		{"config.json", `{"telemetry": {"slow_subscriber_policy": "wait"}}`, "telemetry.slow_subscriber_policy"},
+		{"config.json", `{"policy": {"definitions": {"p": [{"acton": "reject"}]}}}`, `unknown field "policy.definitions.p[0].acton"`},
+		{"config.json", `{"policy": {"definitions": {"p": [{"prefix_list": "x", "action": "deny"}]}}}`,
+			`policy.definitions.p[0].prefix_list: unknown prefix list "x"`},
+		{"config.json", `{"policy": {"definitions": {"p": [{"action": "deny"}]}}}`, "policy.definitions.p[0].action: must be accept or reject"},
+		{"config.json", `{"policy": {"import": {"mock": "p"}}}`, `policy.import.mock: unknown policy "p"`},
+		{"config.json", `{"policy": {"export": "p"}}`, `policy.export: unknown policy "p"`},
+		{"config.json", `{} {}`, "unexpected data"},
+	} {
+		_, err := Load(writeFile(t, tc.name, tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Load(%s) = %v, want error containing %q", tc.content, err, tc.want)
+		}
+	}
+}
+
+func TestLoad_EnvOverrides(t *testing.T) {
+	t.Setenv("AFTSIM_GNMI_PORT", "50300")
+	t.Setenv("AFTSIM_MOCK_INSTALLER_ENABLED", "false")
+	t.Setenv("AFTSIM_LOGGING_LEVEL", "debug")
+
+	cfg, err := Load(writeFile(t, "config.json", `{"gnmi_port": 50200}`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.GNMIPort != 50300 || cfg.Mock.Enabled || cfg.Logging.Level != "debug" {
+		t.Errorf("Expected environment overrides, got %+v", cfg)
+	}
+
+	t.Setenv("AFTSIM_MOCK_INSTALLER_CHURN_RATE", "fast")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "AFTSIM_MOCK_INSTALLER_CHURN_RATE") {
+		t.Errorf("Expected error naming the variable, got %v", err)
+	}
+}
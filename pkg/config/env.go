@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix prefixes the environment variables overriding config fields.
+const EnvPrefix = "AFTSIM_"
+
+// applyEnv overrides scalar fields of cfg from environment variables named
+// after their JSON path, upper-cased and joined with '_', e.g.
+// AFTSIM_GNMI_PORT or AFTSIM_MOCK_INSTALLER_CHURN_RATE. Lists cannot be
+// overridden.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return applyEnvValue(reflect.ValueOf(cfg).Elem(), strings.TrimSuffix(EnvPrefix, "_"), lookup)
+}
+
+func applyEnvValue(v reflect.Value, name string, lookup func(string) (string, bool)) error {
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			if err := applyEnvValue(v.Field(i), name+"_"+strings.ToUpper(tag), lookup); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", name, s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", name, s)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("%s: %s fields cannot be set from the environment", name, v.Kind())
+	}
+	return nil
+}
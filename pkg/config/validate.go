@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// MaxMockRouteCount is the largest route count of the mock installer, which
+// generates distinct 10.x.y.0/24 prefixes.
+const MaxMockRouteCount = 1 << 16
+
+// Validate reports every configuration value the daemon cannot run with.
+// Each error names the offending field.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.GNMIPort >= 1 && c.GNMIPort <= 65535, "gnmi_port", "must be between 1 and 65535, got %d", c.GNMIPort)
+	check(c.MetricsPort >= 0 && c.MetricsPort <= 65535, "metrics_port", "must be between 0 and 65535, got %d", c.MetricsPort)
+	check(c.MetricsPort == 0 || c.MetricsPort != c.GNMIPort, "metrics_port", "must differ from gnmi_port %d", c.GNMIPort)
+
+	check(c.Mock.RouteCount >= 0 && c.Mock.RouteCount <= MaxMockRouteCount,
+		"mock_installer.route_count", "must be between 0 and %d, got %d", MaxMockRouteCount, c.Mock.RouteCount)
+	check(!c.Mock.Enabled || c.Mock.ChurnRate > 0, "mock_installer.churn_rate", "must be greater than 0, got %d", c.Mock.ChurnRate)
+
+	check(c.RIB.Shards >= 0, "rib.shards", "must not be negative, got %d", c.RIB.Shards)
+	aggregates := make(map[netip.Prefix]bool)
+	for i, a := range c.RIB.Aggregates {
+		field := fmt.Sprintf("rib.aggregates[%d]", i)
+		prefix, err := netip.ParsePrefix(a.Prefix)
+		check(err == nil, field+".prefix", "invalid prefix %q", a.Prefix)
+		check(err != nil || !aggregates[prefix.Masked()], field+".prefix", "duplicate aggregate %s", a.Prefix)
+		aggregates[prefix.Masked()] = true
+		_, err = netip.ParseAddr(a.NextHop)
+		check(a.NextHop == "" || err == nil, field+".next_hop", "invalid address %q", a.NextHop)
+	}
+
+	p := c.Policy
+	for _, name := range slices.Sorted(maps.Keys(p.Definitions)) {
+		for i, st := range p.Definitions[name] {
+			field := fmt.Sprintf("policy.definitions.%s[%d]", name, i)
+			_, ok := p.PrefixLists[st.PrefixList]
+			check(st.PrefixList == "" || ok, field+".prefix_list", "unknown prefix list %q", st.PrefixList)
+			check(oneOf(st.Action, "", "accept", "reject"), field+".action", "must be accept or reject, got %q", st.Action)
+			_, err := netip.ParseAddr(st.SetNextHop)
+			check(st.SetNextHop == "" || err == nil, field+".set_next_hop", "invalid address %q", st.SetNextHop)
+		}
+	}
+	for _, installer := range slices.Sorted(maps.Keys(p.Import)) {
+		_, ok := p.Definitions[p.Import[installer]]
+		check(ok, "policy.import."+installer, "unknown policy %q", p.Import[installer])
+	}
+	_, ok := p.Definitions[p.Export]
+	check(p.Export == "" || ok, "policy.export", "unknown policy %q", p.Export)
+
+	t := c.Telemetry
+	check(t.BatchSize >= 0, "telemetry.batch_size", "must not be negative, got %d", t.BatchSize)
+	check(t.BatchLatencyMs >= 0, "telemetry.batch_latency_ms", "must not be negative, got %d", t.BatchLatencyMs)
+	check(t.SubscriberQueueSize >= 0, "telemetry.subscriber_queue_size", "must not be negative, got %d", t.SubscriberQueueSize)
+	check(t.BlockTimeoutMs >= 0, "telemetry.block_timeout_ms", "must not be negative, got %d", t.BlockTimeoutMs)
+	check(oneOf(t.SlowSubscriberPolicy, "", "block", "disconnect", "resync"),
+		"telemetry.slow_subscriber_policy", "must be block, disconnect or resync, got %q", t.SlowSubscriberPolicy)
+	for i, d := range t.DialOut {
+		field := fmt.Sprintf("telemetry.dial_out[%d]", i)
+		check(d.Address != "", field+".address", "must be set")
+		check(oneOf(strings.ToLower(d.Encoding), "", "proto", "json", "json_ietf"),
+			field+".encoding", "must be proto, json or json_ietf, got %q", d.Encoding)
+	}
+
+	check(!c.TLS.ClientAuth || c.TLS.CAFile != "", "tls.client_auth", "requires tls.ca_file")
+	users := make(map[string]bool)
+	for i, u := range c.Auth.Users {
+		field := fmt.Sprintf("auth.users[%d]", i)
+		check(u.Username != "", field+".username", "must be set")
+		check(!users[u.Username], field+".username", "duplicate user %q", u.Username)
+		users[u.Username] = true
+	}
+
+	check(oneOf(strings.ToLower(c.Logging.Level), "", "debug", "info", "warn", "warning", "error"),
+		"logging.level", "must be debug, info, warn or error, got %q", c.Logging.Level)
+	check(oneOf(strings.ToLower(c.Logging.Format), "", "text", "json"),
+		"logging.format", "must be text or json, got %q", c.Logging.Format)
+	check(c.Logging.RouteSampleRate >= 0, "logging.route_sample_rate", "must not be negative, got %d", c.Logging.RouteSampleRate)
+
+	return errors.Join(errs...)
+}
+
+func oneOf(s string, values ...string) bool {
+	return slices.Contains(values, s)
+}
@@ -0,0 +1,110 @@
+// Package dialout defines the gRPC service used for dial-out telemetry, in
+// which the target connects to a collector and pushes the same
+// SubscribeResponse stream a gNMI Subscribe would produce.
+//
+// The service is equivalent to the following definition:
+//
+//	service DialOut {
+//	  rpc Publish(stream gnmi.SubscribeResponse) returns (google.protobuf.Empty);
+//	}
+package dialout
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+const (
+	// ServiceName is the fully qualified name of the dial-out service.
+	ServiceName = "aftsim.dialout.DialOut"
+	// PublishMethod is the full method name of the Publish RPC.
+	PublishMethod = "/" + ServiceName + "/Publish"
+)
+
+// CollectorServer is implemented by collectors receiving dial-out telemetry.
+type CollectorServer interface {
+	// Publish receives the notification stream of a single target.
+	Publish(PublishServer) error
+}
+
+// PublishServer is the collector side of a Publish stream.
+type PublishServer interface {
+	Recv() (*gnmipb.SubscribeResponse, error)
+	SendAndClose(*emptypb.Empty) error
+	grpc.ServerStream
+}
+
+// PublishClient is the target side of a Publish stream.
+type PublishClient interface {
+	Send(*gnmipb.SubscribeResponse) error
+	CloseAndRecv() (*emptypb.Empty, error)
+	grpc.ClientStream
+}
+
+// ServiceDesc describes the dial-out service for grpc.Server registration.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*CollectorServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Publish",
+		Handler:       publishHandler,
+		ClientStreams: true,
+	}},
+}
+
+// RegisterCollectorServer registers srv as the dial-out collector on s.
+func RegisterCollectorServer(s grpc.ServiceRegistrar, srv CollectorServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+func publishHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(CollectorServer).Publish(&publishServer{stream})
+}
+
+type publishServer struct {
+	grpc.ServerStream
+}
+
+func (s *publishServer) Recv() (*gnmipb.SubscribeResponse, error) {
+	m := new(gnmipb.SubscribeResponse)
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *publishServer) SendAndClose(m *emptypb.Empty) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+// NewPublishClient opens a Publish stream on conn.
+func NewPublishClient(ctx context.Context, conn grpc.ClientConnInterface, opts ...grpc.CallOption) (PublishClient, error) {
+	stream, err := conn.NewStream(ctx, &ServiceDesc.Streams[0], PublishMethod, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &publishClient{stream}, nil
+}
+
+type publishClient struct {
+	grpc.ClientStream
+}
+
+func (c *publishClient) Send(m *gnmipb.SubscribeResponse) error {
+	return c.ClientStream.SendMsg(m)
+}
+
+func (c *publishClient) CloseAndRecv() (*emptypb.Empty, error) {
+	if err := c.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(emptypb.Empty)
+	if err := c.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -1,37 +1,113 @@
 package fib
 
 import (
+	"cmp"
 	"context"
-	"fmt"
 	"hash/fnv"
 	"net/netip"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/latency"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+	"github.com/openconfig/aft-simulator/pkg/pipeline"
+)
+
+var logger = logging.For("fib")
+
+var (
+	fibPrefixes = metrics.Default.Gauge("aftsim_fib_prefixes",
+		"Prefixes installed in the FIB.")
+	fibLabels = metrics.Default.Gauge("aftsim_fib_label_entries",
+		"MPLS label entries installed in the FIB.")
+	fibNextHops = metrics.Default.Gauge("aftsim_fib_next_hops",
+		"Next hops referenced by the FIB.")
+	fibNextHopGroups = metrics.Default.Gauge("aftsim_fib_next_hop_groups",
+		"Next-hop groups referenced by the FIB.")
 )
 
 // FIB maintains the active forwarding state.
+//
+// Updates are applied under mu, and the resulting AFTUpdates are sent only
+// after mu is released, so a stalled telemetry server never blocks
+// GetSnapshot. emitMu serializes updates until their AFTUpdates are sent,
+// keeping the telemetry channel in sequence order.
 type FIB struct {
+	emitMu        sync.Mutex
 	mu            sync.RWMutex
-	activeRoutes  map[netip.Prefix]netip.Addr
-	nhRefCount    map[netip.Addr]int
-	nhgRefCount   map[uint64]int
+	activeRoutes  map[netip.Prefix]route
+	labelRoutes   map[uint32]route
+	nhRefCount    map[nextHop]*refEntry
+	nhgRefCount   map[uint64]*refEntry
 	telemetryChan chan<- api.AFTUpdate
+	// seq is the sequence number of the last emitted AFTUpdate.
+	seq uint64
+	// pending holds the AFTUpdates of the update in progress.
+	pending []api.AFTUpdate
+	// stop is canceled when Start stops, releasing an update blocked on a
+	// full telemetryChan.
+	stop   context.Context
+	cancel context.CancelFunc
+}
+
+// nextHop identifies a next hop by its type and, for IP next hops, address
+// or, for interface next hops, interface, together with the labels it
+// pushes.
+type nextHop struct {
+	typ   api.NextHopType
+	addr  netip.Addr
+	iface string
+	// labels is the pushed label stack, formatted by api.LabelStack.String
+	// to keep nextHop comparable.
+	labels string
+}
+
+// pushed returns the label stack pushed by nh.
+func (nh nextHop) pushed() api.LabelStack {
+	labels, _ := api.ParseLabelStack(nh.labels)
+	return labels
+}
+
+func (nh nextHop) String() string {
+	return api.NextHopString(nh.typ, nh.addr, nh.iface, nh.pushed())
+}
+
+// route is an installed prefix or label entry.
+type route struct {
+	nextHop    nextHop
+	lastChange time.Time
+}
+
+// refEntry is a next hop or next-hop group shared by the routes using it.
+type refEntry struct {
+	refs       int
+	nextHop    nextHop // The member of a next-hop group.
+	lastChange time.Time
 }
 
 // New creates a new FIB.
 func New(telemetryChan chan<- api.AFTUpdate) *FIB {
-	return &FIB{
-		activeRoutes:  make(map[netip.Prefix]netip.Addr),
-		nhRefCount:    make(map[netip.Addr]int),
-		nhgRefCount:   make(map[uint64]int),
+	f := &FIB{
+		activeRoutes:  make(map[netip.Prefix]route),
+		labelRoutes:   make(map[uint32]route),
+		nhRefCount:    make(map[nextHop]*refEntry),
+		nhgRefCount:   make(map[uint64]*refEntry),
 		telemetryChan: telemetryChan,
 	}
+	f.stop, f.cancel = context.WithCancel(context.Background())
+	return f
 }
 
-// Start listens for updates on the input channel and processes them.
+// Start listens for updates on the input channel and processes them. Once
+// ctx is canceled, AFTUpdates are dropped rather than waiting for a full
+// output channel.
 func (f *FIB) Start(ctx context.Context, inputChan <-chan api.FIBUpdate) error {
 	defer close(f.telemetryChan)
+	defer f.cancel()
+	context.AfterFunc(ctx, f.cancel)
 	for {
 		select {
 		case <-ctx.Done():
@@ -41,153 +117,477 @@ func (f *FIB) Start(ctx context.Context, inputChan <-chan api.FIBUpdate) error {
 				return nil
 			}
 			f.Update(update)
+			latency.Observe(latency.StageFIB, update.Timestamp)
 		}
 	}
 }
 
-// nhgID generates a deterministic ID for a NextHopGroup based on the NextHop IP.
-func nhgID(nh netip.Addr) uint64 {
+// lock acquires the FIB for an update.
+func (f *FIB) lock() {
+	f.emitMu.Lock()
+	f.mu.Lock()
+}
+
+// unlock releases the FIB and then sends the AFTUpdates of the update,
+// waiting for the telemetry server if its channel is full, unless Start
+// stopped.
+func (f *FIB) unlock() {
+	out := f.pending
+	f.mu.Unlock()
+	for _, update := range out {
+		if pipeline.SendContext(f.stop, f.telemetryChan, update, "telemetry") != nil {
+			break
+		}
+	}
+	clear(out)
+	f.pending = out[:0]
+	f.emitMu.Unlock()
+}
+
+// emit assigns the next sequence number to update and queues it for the
+// telemetry channel. Its EventTime defaults to its Timestamp. Must be called
+// with lock held.
+func (f *FIB) emit(update api.AFTUpdate) {
+	f.seq++
+	update.Seq = f.seq
+	if update.EventTime.IsZero() {
+		update.EventTime = update.Timestamp
+	}
+	f.pending = append(f.pending, update)
+}
+
+// nhgID generates a deterministic ID for a NextHopGroup based on the NextHop
+// type, IP, interface and pushed labels.
+func nhgID(nh nextHop) uint64 {
 	h := fnv.New64a()
-	h.Write(nh.AsSlice())
+	h.Write([]byte(nh.typ))
+	h.Write(nh.addr.AsSlice())
+	h.Write([]byte(nh.iface))
+	if nh.labels != "" {
+		// Separate the labels from the interface, which may contain
+		// slashes.
+		h.Write([]byte{0})
+		h.Write([]byte(nh.labels))
+	}
 	return h.Sum64()
 }
 
 // Update updates the FIB state and notifies the telemetry server.
+// Emitted AFTUpdates carry the timestamp of the FIBUpdate that caused them.
 func (f *FIB) Update(update api.FIBUpdate) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+	f.lock()
+	defer f.unlock()
+	defer f.updateGauges()
+
+	ts := update.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	if update.Label != 0 {
+		f.updateLabel(update, ts)
+		return
+	}
 
 	switch update.Action {
 	case api.Add:
-		// If the route already exists, we might need to handle the old NH/NHG.
-		// For simplicity, let's assume it's a new route or the NH is the same.
-		// A full implementation would decrement ref counts for the old NH/NHG.
-		if oldNH, exists := f.activeRoutes[update.Prefix]; exists && oldNH != update.NextHop {
-			f.deleteRoute(update.Prefix, oldNH)
-		}
-
-		f.activeRoutes[update.Prefix] = update.NextHop
-		nhg := nhgID(update.NextHop)
-
-		// 1. Add NextHop if new
-		f.nhRefCount[update.NextHop]++
-		if f.nhRefCount[update.NextHop] == 1 {
-			f.telemetryChan <- api.AFTUpdate{
-				Action:    api.Add,
-				EntryType: api.AFTEntryNextHop,
-				NextHop:   update.NextHop,
+		nh := updateNextHop(update)
+		nhg := nhgID(nh)
+		if old, exists := f.activeRoutes[update.Prefix]; exists {
+			if old.nextHop == nh {
+				// Unchanged route: refresh the prefix entry only, keeping
+				// its last change time and reference counts.
+				f.emit(api.AFTUpdate{
+					Action:       api.Add,
+					EntryType:    api.AFTEntryPrefix,
+					Prefix:       update.Prefix,
+					NextHopGroup: nhg,
+					Timestamp:    old.lastChange,
+					EventTime:    ts,
+				})
+				return
 			}
+			f.deleteRoute(update.Prefix, old.nextHop, ts)
 		}
 
-		// 2. Add NextHopGroup if new
-		f.nhgRefCount[nhg]++
-		if f.nhgRefCount[nhg] == 1 {
-			f.telemetryChan <- api.AFTUpdate{
-				Action:       api.Add,
-				EntryType:    api.AFTEntryNextHopGroup,
-				NextHopGroup: nhg,
-				NextHop:      update.NextHop,
-			}
-		}
+		f.activeRoutes[update.Prefix] = route{nextHop: nh, lastChange: ts}
+		f.acquire(nh, ts)
 
 		// 3. Add Prefix
-		f.telemetryChan <- api.AFTUpdate{
+		f.emit(api.AFTUpdate{
 			Action:       api.Add,
 			EntryType:    api.AFTEntryPrefix,
 			Prefix:       update.Prefix,
 			NextHopGroup: nhg,
+			Timestamp:    ts,
+		})
+		logging.TraceRoute(logger, "Route programmed", "prefix", update.Prefix,
+			"next_hop", nh.String(), "next_hop_group", nhg)
+
+	case api.Delete:
+		if old, exists := f.activeRoutes[update.Prefix]; exists {
+			f.deleteRoute(update.Prefix, old.nextHop, ts)
+		}
+	}
+}
+
+// updateLabel applies update to the MPLS label entry of update.Label. Label
+// entries share the next hops and next-hop groups of prefixes. Must be
+// called with lock held.
+func (f *FIB) updateLabel(update api.FIBUpdate, ts time.Time) {
+	switch update.Action {
+	case api.Add:
+		nh := updateNextHop(update)
+		nhg := nhgID(nh)
+		if old, exists := f.labelRoutes[update.Label]; exists {
+			if old.nextHop == nh {
+				// Unchanged entry: refresh it only, keeping its last change
+				// time and reference counts.
+				f.emit(api.AFTUpdate{
+					Action:       api.Add,
+					EntryType:    api.AFTEntryLabel,
+					Label:        update.Label,
+					NextHopGroup: nhg,
+					Timestamp:    old.lastChange,
+					EventTime:    ts,
+				})
+				return
+			}
+			f.deleteLabel(update.Label, old.nextHop, ts)
 		}
-		fmt.Printf("FIB: Added/Updated route %s via %s (NHG: %d)\n", update.Prefix, update.NextHop, nhg)
+
+		f.labelRoutes[update.Label] = route{nextHop: nh, lastChange: ts}
+		f.acquire(nh, ts)
+		f.emit(api.AFTUpdate{
+			Action:       api.Add,
+			EntryType:    api.AFTEntryLabel,
+			Label:        update.Label,
+			NextHopGroup: nhg,
+			Timestamp:    ts,
+		})
+		logging.TraceRoute(logger, "Label programmed", "label", update.Label,
+			"next_hop", nh.String(), "next_hop_group", nhg)
 
 	case api.Delete:
-		if oldNH, exists := f.activeRoutes[update.Prefix]; exists {
-			f.deleteRoute(update.Prefix, oldNH)
+		if old, exists := f.labelRoutes[update.Label]; exists {
+			f.deleteLabel(update.Label, old.nextHop, ts)
 		}
 	}
 }
 
-func (f *FIB) deleteRoute(prefix netip.Prefix, nh netip.Addr) {
-	delete(f.activeRoutes, prefix)
-	nhg := nhgID(nh)
+// updateNextHop returns the next hop of update, dropping the fields that do
+// not apply to its type.
+func updateNextHop(update api.FIBUpdate) nextHop {
+	nh := nextHop{typ: update.NextHopType, addr: update.NextHop, iface: update.Interface,
+		labels: update.PushedLabels.String()}
+	if nh.typ != api.NextHopIP {
+		nh.addr = netip.Addr{}
+	}
+	if nh.typ != api.NextHopInterface {
+		nh.iface = ""
+	}
+	return nh
+}
 
-	// 1. Delete Prefix
-	f.telemetryChan <- api.AFTUpdate{
-		Action:    api.Delete,
-		EntryType: api.AFTEntryPrefix,
-		Prefix:    prefix,
+// acquire takes a reference to nh and its next-hop group for a new entry,
+// adding them if new. Must be called with lock held.
+func (f *FIB) acquire(nh nextHop, ts time.Time) {
+	// 1. Add NextHop if new
+	if entry := f.nhRefCount[nh]; entry != nil {
+		entry.refs++
+	} else {
+		f.nhRefCount[nh] = &refEntry{refs: 1, lastChange: ts}
+		f.emit(api.AFTUpdate{
+			Action:       api.Add,
+			EntryType:    api.AFTEntryNextHop,
+			NextHop:      nh.addr,
+			NextHopType:  nh.typ,
+			Interface:    nh.iface,
+			PushedLabels: nh.pushed(),
+			Timestamp:    ts,
+		})
 	}
 
-	// 2. Delete NextHopGroup if no longer used
-	f.nhgRefCount[nhg]--
-	if f.nhgRefCount[nhg] == 0 {
-		delete(f.nhgRefCount, nhg)
-		f.telemetryChan <- api.AFTUpdate{
-			Action:       api.Delete,
+	// 2. Add NextHopGroup if new
+	nhg := nhgID(nh)
+	if group := f.nhgRefCount[nhg]; group != nil {
+		group.refs++
+	} else {
+		f.nhgRefCount[nhg] = &refEntry{refs: 1, nextHop: nh, lastChange: ts}
+		f.emit(api.AFTUpdate{
+			Action:       api.Add,
 			EntryType:    api.AFTEntryNextHopGroup,
 			NextHopGroup: nhg,
+			NextHop:      nh.addr,
+			NextHopType:  nh.typ,
+			Interface:    nh.iface,
+			PushedLabels: nh.pushed(),
+			Timestamp:    ts,
+		})
+	}
+}
+
+// release drops the reference of a removed entry to nh and its next-hop
+// group, deleting them once unused. Must be called with lock held.
+func (f *FIB) release(nh nextHop, ts time.Time) {
+	// 2. Delete NextHopGroup if no longer used
+	nhg := nhgID(nh)
+	if group := f.nhgRefCount[nhg]; group != nil {
+		group.refs--
+		if group.refs == 0 {
+			delete(f.nhgRefCount, nhg)
+			f.emit(api.AFTUpdate{
+				Action:       api.Delete,
+				EntryType:    api.AFTEntryNextHopGroup,
+				NextHopGroup: nhg,
+				Timestamp:    ts,
+			})
 		}
 	}
 
 	// 3. Delete NextHop if no longer used
-	f.nhRefCount[nh]--
-	if f.nhRefCount[nh] == 0 {
-		delete(f.nhRefCount, nh)
-		f.telemetryChan <- api.AFTUpdate{
-			Action:    api.Delete,
-			EntryType: api.AFTEntryNextHop,
-			NextHop:   nh,
+	if entry := f.nhRefCount[nh]; entry != nil {
+		entry.refs--
+		if entry.refs == 0 {
+			delete(f.nhRefCount, nh)
+			f.emit(api.AFTUpdate{
+				Action:       api.Delete,
+				EntryType:    api.AFTEntryNextHop,
+				NextHop:      nh.addr,
+				NextHopType:  nh.typ,
+				Interface:    nh.iface,
+				PushedLabels: nh.pushed(),
+				Timestamp:    ts,
+			})
 		}
 	}
-	fmt.Printf("FIB: Deleted route %s\n", prefix)
 }
 
-// GetSnapshot returns the current state of the FIB as a list of AFTUpdates.
-// This is used to synchronize new telemetry clients.
-func (f *FIB) GetSnapshot() []api.AFTUpdate {
+// updateGauges publishes the FIB size. Must be called with lock held.
+func (f *FIB) updateGauges() {
+	fibPrefixes.Set(float64(len(f.activeRoutes)))
+	fibLabels.Set(float64(len(f.labelRoutes)))
+	fibNextHops.Set(float64(len(f.nhRefCount)))
+	fibNextHopGroups.Set(float64(len(f.nhgRefCount)))
+}
+
+func (f *FIB) deleteRoute(prefix netip.Prefix, nh nextHop, ts time.Time) {
+	delete(f.activeRoutes, prefix)
+
+	// 1. Delete Prefix
+	f.emit(api.AFTUpdate{
+		Action:    api.Delete,
+		EntryType: api.AFTEntryPrefix,
+		Prefix:    prefix,
+		Timestamp: ts,
+	})
+	f.release(nh, ts)
+	logging.TraceRoute(logger, "Route deleted", "prefix", prefix)
+}
+
+func (f *FIB) deleteLabel(label uint32, nh nextHop, ts time.Time) {
+	delete(f.labelRoutes, label)
+	f.emit(api.AFTUpdate{
+		Action:    api.Delete,
+		EntryType: api.AFTEntryLabel,
+		Label:     label,
+		Timestamp: ts,
+	})
+	f.release(nh, ts)
+	logging.TraceRoute(logger, "Label deleted", "label", label)
+}
+
+// GetSnapshot returns the current state of the FIB as a list of AFTUpdates,
+// together with the sequence number of the last update it reflects.
+// This is used to synchronize new telemetry clients: streamed updates with a
+// sequence number at or below the returned one are already in the snapshot.
+// Each entry carries the time it last changed.
+func (f *FIB) GetSnapshot() ([]api.AFTUpdate, uint64) {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
 	var snapshot []api.AFTUpdate
 
 	// 1. Add all NextHops
-	for nh := range f.nhRefCount {
+	for nh, entry := range f.nhRefCount {
 		snapshot = append(snapshot, api.AFTUpdate{
-			Action:    api.Add,
-			EntryType: api.AFTEntryNextHop,
-			NextHop:   nh,
+			Action:       api.Add,
+			EntryType:    api.AFTEntryNextHop,
+			NextHop:      nh.addr,
+			NextHopType:  nh.typ,
+			Interface:    nh.iface,
+			PushedLabels: nh.pushed(),
+			Seq:          f.seq,
+			Timestamp:    entry.lastChange,
 		})
 	}
 
 	// 2. Add all NextHopGroups
-	for nhg := range f.nhgRefCount {
-		// We need to find the NH for this NHG to populate the snapshot correctly.
-		// Since NHG ID is derived from NH, we can find it by iterating over activeRoutes
-		// or we could store the NH in the nhgRefCount map.
-		// For simplicity, let's just find one route that uses this NHG.
-		var nh netip.Addr
-		for _, routeNH := range f.activeRoutes {
-			if nhgID(routeNH) == nhg {
-				nh = routeNH
-				break
-			}
-		}
+	for nhg, group := range f.nhgRefCount {
 		snapshot = append(snapshot, api.AFTUpdate{
 			Action:       api.Add,
 			EntryType:    api.AFTEntryNextHopGroup,
 			NextHopGroup: nhg,
-			NextHop:      nh,
+			NextHop:      group.nextHop.addr,
+			NextHopType:  group.nextHop.typ,
+			Interface:    group.nextHop.iface,
+			PushedLabels: group.nextHop.pushed(),
+			Seq:          f.seq,
+			Timestamp:    group.lastChange,
 		})
 	}
 
 	// 3. Add all Prefixes
-	for prefix, nh := range f.activeRoutes {
+	for prefix, r := range f.activeRoutes {
 		snapshot = append(snapshot, api.AFTUpdate{
 			Action:       api.Add,
 			EntryType:    api.AFTEntryPrefix,
 			Prefix:       prefix,
-			NextHopGroup: nhgID(nh),
+			NextHopGroup: nhgID(r.nextHop),
+			Seq:          f.seq,
+			Timestamp:    r.lastChange,
+		})
+	}
+
+	// 4. Add all label entries
+	for label, r := range f.labelRoutes {
+		snapshot = append(snapshot, api.AFTUpdate{
+			Action:       api.Add,
+			EntryType:    api.AFTEntryLabel,
+			Label:        label,
+			NextHopGroup: nhgID(r.nextHop),
+			Seq:          f.seq,
+			Timestamp:    r.lastChange,
 		})
 	}
 
-	return snapshot
+	return snapshot, f.seq
+}
+
+// Entry is an installed prefix.
+type Entry struct {
+	Prefix       netip.Prefix
+	NextHop      netip.Addr
+	NextHopType  api.NextHopType
+	Interface    string
+	PushedLabels api.LabelStack
+	NextHopGroup uint64
+	LastChange   time.Time
+}
+
+// LabelEntry is an installed MPLS label entry. It pops Label and pushes
+// PushedLabels, if any.
+type LabelEntry struct {
+	Label        uint32
+	NextHop      netip.Addr
+	NextHopType  api.NextHopType
+	Interface    string
+	PushedLabels api.LabelStack
+	NextHopGroup uint64
+	LastChange   time.Time
+}
+
+// NextHopGroup is a next-hop group and the number of prefixes and label
+// entries using it.
+type NextHopGroup struct {
+	ID           uint64
+	NextHop      netip.Addr
+	NextHopType  api.NextHopType
+	Interface    string
+	PushedLabels api.LabelStack
+	RefCount     int
+	LastChange   time.Time
+}
+
+// NextHop is a next hop and the number of prefixes and label entries using
+// it.
+type NextHop struct {
+	Address      netip.Addr
+	Type         api.NextHopType
+	Interface    string
+	PushedLabels api.LabelStack
+	RefCount     int
+	LastChange   time.Time
+}
+
+// Entries returns the installed prefixes, sorted by prefix.
+func (f *FIB) Entries() []Entry {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(f.activeRoutes))
+	for prefix, r := range f.activeRoutes {
+		entries = append(entries, Entry{
+			Prefix:       prefix,
+			NextHop:      r.nextHop.addr,
+			NextHopType:  r.nextHop.typ,
+			Interface:    r.nextHop.iface,
+			PushedLabels: r.nextHop.pushed(),
+			NextHopGroup: nhgID(r.nextHop),
+			LastChange:   r.lastChange,
+		})
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return comparePrefix(a.Prefix, b.Prefix) })
+	return entries
+}
+
+// LabelEntries returns the installed MPLS label entries, sorted by label.
+func (f *FIB) LabelEntries() []LabelEntry {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	entries := make([]LabelEntry, 0, len(f.labelRoutes))
+	for label, r := range f.labelRoutes {
+		entries = append(entries, LabelEntry{
+			Label:        label,
+			NextHop:      r.nextHop.addr,
+			NextHopType:  r.nextHop.typ,
+			Interface:    r.nextHop.iface,
+			PushedLabels: r.nextHop.pushed(),
+			NextHopGroup: nhgID(r.nextHop),
+			LastChange:   r.lastChange,
+		})
+	}
+	slices.SortFunc(entries, func(a, b LabelEntry) int { return cmp.Compare(a.Label, b.Label) })
+	return entries
+}
+
+// NextHopGroups returns the next-hop groups with their reference counts,
+// sorted by ID.
+func (f *FIB) NextHopGroups() []NextHopGroup {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	groups := make([]NextHopGroup, 0, len(f.nhgRefCount))
+	for id, group := range f.nhgRefCount {
+		groups = append(groups, NextHopGroup{ID: id, NextHop: group.nextHop.addr, NextHopType: group.nextHop.typ,
+			Interface: group.nextHop.iface, PushedLabels: group.nextHop.pushed(), RefCount: group.refs,
+			LastChange: group.lastChange})
+	}
+	slices.SortFunc(groups, func(a, b NextHopGroup) int { return cmp.Compare(a.ID, b.ID) })
+	return groups
+}
+
+// NextHops returns the next hops with their reference counts, sorted by
+// type, address, interface and pushed labels.
+func (f *FIB) NextHops() []NextHop {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	nhs := make([]NextHop, 0, len(f.nhRefCount))
+	for key, nh := range f.nhRefCount {
+		nhs = append(nhs, NextHop{Address: key.addr, Type: key.typ, Interface: key.iface, PushedLabels: key.pushed(),
+			RefCount: nh.refs, LastChange: nh.lastChange})
+	}
+	slices.SortFunc(nhs, func(a, b NextHop) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), a.Address.Compare(b.Address), cmp.Compare(a.Interface, b.Interface),
+			slices.Compare(a.PushedLabels, b.PushedLabels))
+	})
+	return nhs
+}
+
+func comparePrefix(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Bits(), b.Bits())
 }
@@ -1,6 +1,7 @@
 package fib
 
 import (
+	"context"
 	"net/netip"
 	"testing"
 	"time"
@@ -106,10 +107,13 @@ func TestFIB_GetSnapshot(t *testing.T) {
 		<-telemetryChan
 	}
 
-	snapshot := f.GetSnapshot()
+	snapshot, seq := f.GetSnapshot()
 	if len(snapshot) != 6 {
 		t.Fatalf("Expected snapshot length 6, got %d", len(snapshot))
 	}
+	if seq != 6 {
+		t.Errorf("Expected snapshot sequence 6, got %d", seq)
+	}
 
 	foundPrefix1 := false
 	foundPrefix2 := false
@@ -120,6 +124,9 @@ func TestFIB_GetSnapshot(t *testing.T) {
 		if update.Action != api.Add {
 			t.Errorf("Expected snapshot items to be ADD, got %v", update.Action)
 		}
+		if update.Seq != seq {
+			t.Errorf("Expected snapshot items to carry sequence %d, got %d", seq, update.Seq)
+		}
 		if update.EntryType == api.AFTEntryPrefix {
 			if update.Prefix == prefix1 {
 				foundPrefix1 = true
@@ -151,3 +158,298 @@ func TestFIB_GetSnapshot(t *testing.T) {
 		t.Errorf("Snapshot missing nh2")
 	}
 }
+
+func TestFIB_DropNextHop(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 10)
+	f := New(telemetryChan)
+
+	prefix1 := netip.MustParsePrefix("10.0.0.0/8")
+	prefix2 := netip.MustParsePrefix("172.16.0.0/12")
+	// The address of a drop next hop is ignored.
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: prefix1, NextHopType: api.NextHopDrop})
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: prefix2, NextHopType: api.NextHopDrop, NextHop: netip.MustParseAddr("192.168.1.1")})
+
+	// Both prefixes share the drop next hop and its group.
+	for i := 0; i < 4; i++ {
+		update := <-telemetryChan
+		if update.EntryType == api.AFTEntryPrefix {
+			continue
+		}
+		if update.NextHopType != api.NextHopDrop || update.NextHop.IsValid() {
+			t.Errorf("Expected a drop next hop, got %+v", update)
+		}
+	}
+	if len(telemetryChan) != 0 {
+		t.Fatalf("Expected no more updates, got %d", len(telemetryChan))
+	}
+	nhs := f.NextHops()
+	if len(nhs) != 1 || nhs[0].Type != api.NextHopDrop || nhs[0].RefCount != 2 {
+		t.Errorf("Expected a single drop next hop referenced twice, got %+v", nhs)
+	}
+
+	// An IP next hop gets its own group.
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: prefix2, NextHop: netip.MustParseAddr("192.168.1.1")})
+	for i := 0; i < 3; i++ {
+		if update := <-telemetryChan; update.EntryType != api.AFTEntryPrefix && !update.NextHop.IsValid() {
+			t.Errorf("Expected an IP next hop, got %+v", update)
+		}
+	}
+	if nhs := f.NextHops(); len(nhs) != 2 || nhs[0].Type != api.NextHopIP || nhs[1].RefCount != 1 {
+		t.Errorf("Unexpected next hops %+v", nhs)
+	}
+}
+
+func TestFIB_InterfaceNextHop(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 10)
+	f := New(telemetryChan)
+
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/24"), NextHopType: api.NextHopInterface, Interface: "eth0"})
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.1.0/24"), NextHopType: api.NextHopInterface, Interface: "eth1"})
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.2.1/32"), NextHopType: api.NextHopReceive, Interface: "eth0"})
+
+	// Each interface is a next hop of its own; the interface of a receive
+	// next hop is ignored.
+	nhs := f.NextHops()
+	if len(nhs) != 3 || nhs[0].Interface != "eth0" || nhs[1].Interface != "eth1" ||
+		nhs[2].Type != api.NextHopReceive || nhs[2].Interface != "" {
+		t.Errorf("Unexpected next hops %+v", nhs)
+	}
+	if groups := f.NextHopGroups(); len(groups) != 3 {
+		t.Errorf("Expected 3 next-hop groups, got %+v", groups)
+	}
+	for range 9 {
+		update := <-telemetryChan
+		if update.EntryType == api.AFTEntryNextHop && update.NextHopType == api.NextHopInterface && update.Interface == "" {
+			t.Errorf("Expected the interface of %+v", update)
+		}
+	}
+}
+
+func TestFIB_LabelEntries(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 20)
+	f := New(telemetryChan)
+
+	nh := netip.MustParseAddr("192.168.1.1")
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/24"), NextHop: nh,
+		PushedLabels: api.LabelStack{16001}})
+	f.Update(api.FIBUpdate{Action: api.Add, Label: 16001, NextHop: nh})
+	f.Update(api.FIBUpdate{Action: api.Add, Label: 16002, NextHop: nh, PushedLabels: api.LabelStack{16001}})
+
+	// The pushed labels make a next hop of their own, shared by the prefix
+	// and the swapping label entry.
+	nhs := f.NextHops()
+	if len(nhs) != 2 || len(nhs[0].PushedLabels) != 0 || nhs[0].RefCount != 1 ||
+		nhs[1].PushedLabels.String() != "16001" || nhs[1].RefCount != 2 {
+		t.Errorf("Unexpected next hops %+v", nhs)
+	}
+	entries := f.LabelEntries()
+	if len(entries) != 2 || entries[0].Label != 16001 || entries[1].Label != 16002 ||
+		entries[0].NextHopGroup == entries[1].NextHopGroup {
+		t.Errorf("Unexpected label entries %+v", entries)
+	}
+	if snapshot, _ := f.GetSnapshot(); len(snapshot) != 7 {
+		t.Errorf("Expected 7 snapshot entries, got %d", len(snapshot))
+	}
+
+	// Re-adding an unchanged label entry keeps its last change time.
+	for len(telemetryChan) > 0 {
+		<-telemetryChan
+	}
+	ts := time.Unix(1000, 0)
+	f.Update(api.FIBUpdate{Action: api.Add, Label: 16001, NextHop: nh, Timestamp: ts})
+	if update := <-telemetryChan; !update.Timestamp.Equal(entries[0].LastChange) || !update.EventTime.Equal(ts) {
+		t.Errorf("Expected timestamp %v and event time %v, got %+v", entries[0].LastChange, ts, update)
+	}
+
+	// Deleting a label entry releases its next hop, not the prefix.
+	for len(telemetryChan) > 0 {
+		<-telemetryChan
+	}
+	f.Update(api.FIBUpdate{Action: api.Delete, Label: 16001})
+	want := []api.AFTEntryType{api.AFTEntryLabel, api.AFTEntryNextHopGroup, api.AFTEntryNextHop}
+	for _, typ := range want {
+		if update := <-telemetryChan; update.Action != api.Delete || update.EntryType != typ {
+			t.Errorf("Expected DELETE %s, got %+v", typ, update)
+		}
+	}
+	if len(f.Entries()) != 1 || len(f.LabelEntries()) != 1 {
+		t.Errorf("Expected one prefix and one label entry left")
+	}
+}
+
+func TestFIB_Update_SequenceNumbers(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 10)
+	f := New(telemetryChan)
+
+	prefix := netip.MustParsePrefix("10.0.0.0/24")
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.1")})
+	// Changing the next hop deletes the old entries and adds the new ones.
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.2")})
+
+	var last uint64
+	for len(telemetryChan) > 0 {
+		update := <-telemetryChan
+		if update.Seq != last+1 {
+			t.Errorf("Expected sequence %d, got %d (%+v)", last+1, update.Seq, update)
+		}
+		last = update.Seq
+	}
+	if last != 9 {
+		t.Errorf("Expected 9 updates, got %d", last)
+	}
+}
+
+func TestFIB_Update_Timestamps(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 20)
+	f := New(telemetryChan)
+
+	p1 := netip.MustParsePrefix("10.0.0.0/24")
+	p2 := netip.MustParsePrefix("10.0.1.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	t1 := time.Unix(1000, 0)
+	t2 := time.Unix(2000, 0)
+
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: p1, NextHop: nh, Timestamp: t1})
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: p2, NextHop: nh, Timestamp: t2})
+	// Re-adding an unchanged route keeps its last change time.
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: p1, NextHop: nh, Timestamp: t2})
+
+	for len(telemetryChan) > 0 {
+		update := <-telemetryChan
+		want := t2
+		if update.Prefix == p1 || update.EntryType != api.AFTEntryPrefix {
+			want = t1
+		}
+		if !update.Timestamp.Equal(want) {
+			t.Errorf("Expected timestamp %v on %+v", want, update)
+		}
+	}
+
+	// The refresh still measures latency from the event that caused it.
+	t3 := time.Unix(3000, 0)
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: p1, NextHop: nh, Timestamp: t3})
+	if update := <-telemetryChan; !update.Timestamp.Equal(t1) || !update.EventTime.Equal(t3) {
+		t.Errorf("Expected timestamp %v and event time %v, got %+v", t1, t3, update)
+	}
+
+	snapshot, _ := f.GetSnapshot()
+	if len(snapshot) != 4 {
+		t.Fatalf("Expected 4 snapshot entries, got %d", len(snapshot))
+	}
+	for _, update := range snapshot {
+		want := t1
+		if update.Prefix == p2 {
+			want = t2
+		}
+		if !update.Timestamp.Equal(want) {
+			t.Errorf("Expected snapshot timestamp %v on %+v", want, update)
+		}
+		if update.EntryType == api.AFTEntryNextHopGroup && update.NextHop != nh {
+			t.Errorf("Expected next-hop group member %s, got %s", nh, update.NextHop)
+		}
+	}
+}
+
+func TestFIB_Introspection(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 20)
+	f := New(telemetryChan)
+
+	p1 := netip.MustParsePrefix("10.0.1.0/24")
+	p2 := netip.MustParsePrefix("10.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: p1, NextHop: nh})
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: p2, NextHop: nh})
+
+	entries := f.Entries()
+	if len(entries) != 2 || entries[0].Prefix != p2 || entries[1].Prefix != p1 {
+		t.Errorf("Expected entries sorted by prefix, got %+v", entries)
+	}
+	groups := f.NextHopGroups()
+	if len(groups) != 1 || groups[0].RefCount != 2 || groups[0].NextHop != nh || groups[0].ID != entries[0].NextHopGroup {
+		t.Errorf("Expected one next-hop group used twice, got %+v", groups)
+	}
+	nhs := f.NextHops()
+	if len(nhs) != 1 || nhs[0].Address != nh || nhs[0].RefCount != 2 {
+		t.Errorf("Expected one next hop used twice, got %+v", nhs)
+	}
+}
+
+func TestFIB_StalledTelemetry(t *testing.T) {
+	// An unbuffered channel that nobody reads stalls the FIB on its first
+	// AFTUpdate, like a telemetry server that has stopped draining.
+	telemetryChan := make(chan api.AFTUpdate)
+	f := New(telemetryChan)
+
+	prefix := netip.MustParsePrefix("10.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	done := make(chan struct{})
+	go func() {
+		f.Update(api.FIBUpdate{Action: api.Add, Prefix: prefix, NextHop: nh})
+		close(done)
+	}()
+
+	// The snapshot must not wait for the stalled update, yet already
+	// reflect it: all three AFTUpdates are at or below its sequence number.
+	deadline := time.After(time.Second)
+	for {
+		snapDone := make(chan uint64)
+		go func() {
+			_, seq := f.GetSnapshot()
+			snapDone <- seq
+		}()
+		var seq uint64
+		select {
+		case seq = <-snapDone:
+		case <-deadline:
+			t.Fatal("GetSnapshot blocked by stalled telemetry channel")
+		}
+		if seq == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if entries := f.Entries(); len(entries) != 1 || entries[0].Prefix != prefix {
+		t.Errorf("Expected %s installed, got %+v", prefix, entries)
+	}
+
+	// Draining the channel releases the update, in sequence order.
+	for want := uint64(1); want <= 3; want++ {
+		select {
+		case update := <-telemetryChan:
+			if update.Seq != want {
+				t.Errorf("Expected seq %d, got %d", want, update.Seq)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for AFT update %d", want)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Update did not return after telemetry drained")
+	}
+}
+
+func TestFIB_Start_StopWithFullTelemetry(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	telemetryChan := make(chan api.AFTUpdate, 1)
+	f := New(telemetryChan)
+
+	fibChan <- api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/24"), NextHop: netip.MustParseAddr("192.168.1.1")}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- f.Start(ctx, fibChan) }()
+
+	// Nobody reads the telemetry channel, so the update blocks once it is
+	// full.
+	for len(telemetryChan) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return with the telemetry channel full")
+	}
+}
@@ -2,68 +2,152 @@ package mock
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
 	"net/netip"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/openconfig/aft-simulator/pkg/api"
 	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/latency"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/pipeline"
 )
 
-// MockInstaller injects a sequence of route updates.
+var logger = logging.For("mock")
+
+// Name is the installer name of the mock installer, which selects its
+// import policy.
+const Name = "mock"
+
+// MockInstaller injects a sequence of route updates. Its configuration can
+// be changed while it runs with Reconfigure.
 type MockInstaller struct {
-	cfg config.MockConfig
+	mu     sync.Mutex
+	cfg    config.MockConfig
+	reload chan config.MockConfig
+
+	paused atomic.Bool
+	routes atomic.Int64
 }
 
 // New creates a new MockInstaller.
 func New(cfg config.MockConfig) *MockInstaller {
-	return &MockInstaller{cfg: cfg}
+	return &MockInstaller{cfg: cfg, reload: make(chan config.MockConfig, 1)}
 }
 
-// Run begins the mock installer loop.
-func (m *MockInstaller) Run(ctx context.Context, ribChan chan<- api.RIBUpdate) error {
-	if !m.cfg.Enabled {
-		return nil
+// Reconfigure applies cfg to the running installer. Additional routes are
+// installed when the route count grows and the excess ones are withdrawn
+// when it shrinks; disabling the installer withdraws all of its routes.
+// If several configurations are pending, only the latest is applied.
+func (m *MockInstaller) Reconfigure(cfg config.MockConfig) {
+	for {
+		select {
+		case m.reload <- cfg:
+			return
+		default:
+		}
+		// Replace the pending configuration.
+		select {
+		case <-m.reload:
+		default:
+		}
 	}
+}
 
-	fmt.Printf("MockInstaller: Starting with target %d routes, churn rate %d/s\n", m.cfg.RouteCount, m.cfg.ChurnRate)
+// Pause stops churn until Resume is called. Routes already installed stay
+// in place and reconfiguration is still applied.
+func (m *MockInstaller) Pause() {
+	m.paused.Store(true)
+	logger.Info("Paused")
+}
 
-	// Generate initial routes
-	prefixes := generatePrefixes(m.cfg.RouteCount)
-	nextHops := []netip.Addr{
-		netip.MustParseAddr("192.168.1.1"),
-		netip.MustParseAddr("192.168.1.2"),
-		netip.MustParseAddr("192.168.1.3"),
-		netip.MustParseAddr("192.168.1.4"),
-	}
+// Resume restarts churn after Pause.
+func (m *MockInstaller) Resume() {
+	m.paused.Store(false)
+	logger.Info("Resumed")
+}
 
-	// Initial population
-	ticker := time.NewTicker(time.Second / time.Duration(m.cfg.ChurnRate))
-	if m.cfg.ChurnRate <= 0 {
-		ticker = time.NewTicker(time.Second) // Default slow if invalid
+// Status reports the state of the installer.
+func (m *MockInstaller) Status() api.InstallerStatus {
+	m.mu.Lock()
+	cfg := m.cfg
+	m.mu.Unlock()
+	return api.InstallerStatus{
+		Protocol:  api.ProtocolMock,
+		Enabled:   cfg.Enabled,
+		Paused:    m.paused.Load(),
+		Routes:    int(m.routes.Load()),
+		ChurnRate: cfg.ChurnRate,
 	}
+}
+
+var nextHops = []netip.Addr{
+	netip.MustParseAddr("192.168.1.1"),
+	netip.MustParseAddr("192.168.1.2"),
+	netip.MustParseAddr("192.168.1.3"),
+	netip.MustParseAddr("192.168.1.4"),
+}
+
+// Run begins the mock installer loop. It keeps running while disabled so
+// that it can be enabled by Reconfigure.
+func (m *MockInstaller) Run(ctx context.Context, ribChan chan<- api.RIBUpdate) error {
+	// installed holds the prefixes owned by the installer; churn may have
+	// withdrawn some of them from the RIB.
+	var installed []netip.Prefix
+	ticker := time.NewTicker(time.Second)
+	ticker.Stop()
 	defer ticker.Stop()
 
-	// Initial Load Phase
-	fmt.Println("MockInstaller: Initializing routes...")
-	for i, p := range prefixes {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			nh := nextHops[i%len(nextHops)]
-			ribChan <- api.RIBUpdate{
-				Action:    api.Add,
-				Protocol:  api.ProtocolMock,
-				Prefix:    p,
-				NextHop:   nh,
-				Metric:    10,
-				AdminDist: 1,
+	// apply moves the installed routes and churn rate to cfg.
+	apply := func(cfg config.MockConfig) error {
+		target := 0
+		if cfg.Enabled {
+			target = cfg.RouteCount
+		}
+		logger.Info("Applying configuration", "enabled", cfg.Enabled, "route_count", cfg.RouteCount, "churn_rate", cfg.ChurnRate)
+
+		if target > len(installed) {
+			logger.Info("Installing routes", "count", target-len(installed))
+			prefixes := generatePrefixes(target)
+			for i := len(installed); i < target; i++ {
+				if err := send(ctx, ribChan, api.Add, prefixes[i], nextHops[i%len(nextHops)]); err != nil {
+					return err
+				}
 			}
+			installed = prefixes
+			logger.Info("Routes installed")
 		}
+		if target < len(installed) {
+			logger.Info("Withdrawing routes", "count", len(installed)-target)
+			for _, p := range installed[target:] {
+				if err := send(ctx, ribChan, api.Delete, p, netip.Addr{}); err != nil {
+					return err
+				}
+			}
+			installed = installed[:target]
+		}
+
+		m.routes.Store(int64(len(installed)))
+		if len(installed) == 0 {
+			ticker.Stop()
+			return nil
+		}
+		if cfg.ChurnRate > 0 {
+			ticker.Reset(time.Second / time.Duration(cfg.ChurnRate))
+		} else {
+			ticker.Reset(time.Second) // Default slow if invalid
+		}
+		return nil
+	}
+
+	m.mu.Lock()
+	cfg := m.cfg
+	m.mu.Unlock()
+	if err := apply(cfg); err != nil {
+		return err
 	}
-	fmt.Println("MockInstaller: Initial load complete.")
 
 	// Churn Phase
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -71,32 +155,55 @@ func (m *MockInstaller) Run(ctx context.Context, ribChan chan<- api.RIBUpdate) e
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case cfg := <-m.reload:
+			m.mu.Lock()
+			m.cfg = cfg
+			m.mu.Unlock()
+			if err := apply(cfg); err != nil {
+				return err
+			}
 		case <-ticker.C:
+			if m.paused.Load() {
+				continue
+			}
 			// Pick a random prefix to update
-			idx := rng.Intn(len(prefixes))
-			p := prefixes[idx]
-			
+			p := installed[rng.Intn(len(installed))]
+
 			// Toggle between two next-hops or flap
 			nh := nextHops[rng.Intn(len(nextHops))]
-			
+
 			// 10% chance to delete, 90% to update/add
 			action := api.Add
 			if rng.Float32() < 0.1 {
 				action = api.Delete
 			}
 
-			ribChan <- api.RIBUpdate{
-				Action:    action,
-				Protocol:  api.ProtocolMock,
-				Prefix:    p,
-				NextHop:   nh,
-				Metric:    10,
-				AdminDist: 1,
+			if err := send(ctx, ribChan, action, p, nh); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// send injects a mock route update into ribChan.
+func send(ctx context.Context, ribChan chan<- api.RIBUpdate, action api.ActionType, p netip.Prefix, nh netip.Addr) error {
+	update := api.RIBUpdate{
+		Action:    action,
+		Protocol:  api.ProtocolMock,
+		Installer: Name,
+		Prefix:    p,
+		NextHop:   nh,
+		Metric:    10,
+		AdminDist: 1,
+		Timestamp: time.Now(),
+	}
+	if err := pipeline.SendContext(ctx, ribChan, update, "rib"); err != nil {
+		return err
+	}
+	latency.Observe(latency.StageInstaller, update.Timestamp)
+	return nil
+}
+
 func generatePrefixes(count int) []netip.Prefix {
 	prefixes := make([]netip.Prefix, 0, count)
 	// Generate 10.x.y.0/24
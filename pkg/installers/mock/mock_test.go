@@ -0,0 +1,61 @@
+package mock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+)
+
+// collect reads n updates from ribChan.
+func collect(t *testing.T, ribChan <-chan api.RIBUpdate, n int) []api.RIBUpdate {
+	t.Helper()
+	var updates []api.RIBUpdate
+	for len(updates) < n {
+		select {
+		case u := <-ribChan:
+			updates = append(updates, u)
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout after %d of %d updates", len(updates), n)
+		}
+	}
+	return updates
+}
+
+func TestMockInstaller_Reconfigure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ribChan := make(chan api.RIBUpdate, 100)
+	// A low churn rate keeps churn out of the way of the test.
+	m := New(config.MockConfig{Enabled: true, RouteCount: 10, ChurnRate: 0})
+	go m.Run(ctx, ribChan)
+
+	for _, u := range collect(t, ribChan, 10) {
+		if u.Action != api.Add {
+			t.Errorf("Expected initial ADD, got %+v", u)
+		}
+	}
+
+	// Growing the route count installs only the new routes.
+	m.Reconfigure(config.MockConfig{Enabled: true, RouteCount: 15})
+	added := collect(t, ribChan, 5)
+	if added[0].Action != api.Add || added[0].Prefix != generatePrefixes(15)[10] {
+		t.Errorf("Expected ADD of the 11th prefix, got %+v", added[0])
+	}
+
+	// Disabling the installer withdraws everything it installed.
+	m.Reconfigure(config.MockConfig{Enabled: false, RouteCount: 15})
+	deleted := map[string]bool{}
+	for _, u := range collect(t, ribChan, 15) {
+		if u.Action != api.Delete {
+			t.Errorf("Expected DELETE, got %+v", u)
+		}
+		deleted[u.Prefix.String()] = true
+	}
+	if len(deleted) != 15 {
+		t.Errorf("Expected 15 distinct withdrawals, got %d", len(deleted))
+	}
+}
@@ -0,0 +1,92 @@
+// Package latency measures how long route events take to propagate through
+// the simulator pipeline.
+//
+// Every event is stamped when the installer emits it. Each stage records the
+// time elapsed since that stamp once it has handled the event, so the
+// latency reported for a stage is cumulative: it includes all earlier
+// stages and the queues between them.
+package latency
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+)
+
+// Stage is a point in the pipeline at which latency is recorded.
+type Stage string
+
+// Pipeline stages, in order.
+const (
+	// StageInstaller is recorded once the RIB channel accepts the update.
+	StageInstaller Stage = "installer"
+	// StageRIB is recorded once the RIB has selected the best path.
+	StageRIB Stage = "rib"
+	// StageFIB is recorded once the FIB has been programmed.
+	StageFIB Stage = "fib"
+	// StageGNMI is recorded once a notification carrying the update has
+	// been sent to a telemetry receiver, once per receiver.
+	StageGNMI Stage = "gnmi"
+)
+
+// Stages lists all stages in pipeline order.
+var Stages = []Stage{StageInstaller, StageRIB, StageFIB, StageGNMI}
+
+var (
+	stageLatency = metrics.Default.SummaryVec("aftsim_convergence_latency_seconds",
+		"Time from installer emit until a pipeline stage handled the update, by stage.", "stage")
+	stageUpdates = metrics.Default.CounterVec("aftsim_pipeline_updates_total",
+		"Updates handled, by pipeline stage.", "stage")
+)
+
+// Observe counts an update handled by stage and records its latency since
+// emitted. The latency of updates without a timestamp is not recorded.
+func Observe(stage Stage, emitted time.Time) {
+	stageUpdates.With(string(stage)).Inc()
+	if emitted.IsZero() {
+		return
+	}
+	stageLatency.With(string(stage)).Observe(time.Since(emitted).Seconds())
+}
+
+// StageReport summarizes the latency of one stage.
+type StageReport struct {
+	Stage Stage         `json:"stage"`
+	Count uint64        `json:"count"`
+	P50   time.Duration `json:"p50_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// Report returns the latency of every stage in pipeline order. Quantiles
+// cover the most recent updates of each stage.
+func Report() []StageReport {
+	var report []StageReport
+	for _, stage := range Stages {
+		snap := stageLatency.With(string(stage)).Snapshot()
+		report = append(report, StageReport{
+			Stage: stage,
+			Count: snap.Count,
+			P50:   seconds(snap.P50),
+			P99:   seconds(snap.P99),
+			Max:   seconds(snap.Max),
+		})
+	}
+	return report
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Handler returns an HTTP handler serving Report as JSON.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Report()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package latency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	Observe(StageFIB, time.Now().Add(-10*time.Millisecond))
+	Observe(StageFIB, time.Now().Add(-20*time.Millisecond))
+	// Updates without a timestamp are not recorded.
+	Observe(StageFIB, time.Time{})
+
+	var fib StageReport
+	report := Report()
+	if len(report) != len(Stages) {
+		t.Fatalf("Expected %d stages, got %d", len(Stages), len(report))
+	}
+	for i, r := range report {
+		if r.Stage != Stages[i] {
+			t.Errorf("Expected stage %s at %d, got %s", Stages[i], i, r.Stage)
+		}
+		if r.Stage == StageFIB {
+			fib = r
+		}
+	}
+	if fib.Count != 2 {
+		t.Errorf("Expected 2 FIB observations, got %d", fib.Count)
+	}
+	if fib.Max < 20*time.Millisecond || fib.P50 < 10*time.Millisecond || fib.P50 > fib.Max {
+		t.Errorf("Unexpected FIB latency %+v", fib)
+	}
+}
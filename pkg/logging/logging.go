@@ -0,0 +1,146 @@
+// Package logging provides the simulator's levelled, structured loggers.
+//
+// Every component logs through a logger returned by For, which tags records
+// with the component name. Level, format and route sampling are global and
+// can be changed at any time with Configure; existing loggers pick up the
+// change immediately.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openconfig/aft-simulator/pkg/config"
+)
+
+var (
+	level  = new(slog.LevelVar)
+	output atomic.Pointer[slog.Handler]
+
+	// sampleRate and routeEvents implement route event sampling.
+	sampleRate  atomic.Int64
+	routeEvents atomic.Uint64
+)
+
+func init() {
+	setOutput(newHandler(os.Stderr, "text"))
+	sampleRate.Store(1)
+}
+
+// ParseLevel converts s into a slog level. An empty string selects info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Configure applies cfg to all loggers and makes the daemon logger the
+// slog and log package default.
+func Configure(cfg config.LogConfig) error {
+	return ConfigureOutput(os.Stderr, cfg)
+}
+
+// Validate reports whether cfg can be applied by Configure.
+func Validate(cfg config.LogConfig) error {
+	if _, err := ParseLevel(cfg.Level); err != nil {
+		return err
+	}
+	switch strings.ToLower(cfg.Format) {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q", cfg.Format)
+}
+
+// ConfigureOutput is Configure writing to w.
+func ConfigureOutput(w io.Writer, cfg config.LogConfig) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	l, _ := ParseLevel(cfg.Level)
+	format := strings.ToLower(cfg.Format)
+
+	level.Set(l)
+	setOutput(newHandler(w, format))
+	sampleRate.Store(int64(max(cfg.RouteSampleRate, 1)))
+	slog.SetDefault(For("daemon"))
+	return nil
+}
+
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func setOutput(h slog.Handler) {
+	output.Store(&h)
+}
+
+// For returns the logger of component.
+func For(component string) *slog.Logger {
+	return slog.New(&handler{}).With("component", component)
+}
+
+// TraceRoute logs a route event at debug level, sampled according to the
+// configured route sample rate.
+func TraceRoute(logger *slog.Logger, msg string, args ...any) {
+	ctx := context.Background()
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	if rate := uint64(sampleRate.Load()); rate > 1 && routeEvents.Add(1)%rate != 0 {
+		return
+	}
+	logger.DebugContext(ctx, msg, args...)
+}
+
+// handler forwards records to the current output handler, replaying the
+// attributes and groups added to the logger.
+type handler struct {
+	wrap []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) current() slog.Handler {
+	out := *output.Load()
+	for _, w := range h.wrap {
+		out = w(out)
+	}
+	return out
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.current().Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
+
+func (h *handler) with(w func(slog.Handler) slog.Handler) slog.Handler {
+	wrap := append(h.wrap[:len(h.wrap):len(h.wrap)], w)
+	return &handler{wrap: wrap}
+}
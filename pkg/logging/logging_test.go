@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/config"
+)
+
+func TestConfigure(t *testing.T) {
+	var b strings.Builder
+	logger := For("rib")
+	if err := ConfigureOutput(&b, config.LogConfig{Level: "warn", Format: "json"}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "prefix", "10.0.0.0/24")
+
+	got := b.String()
+	if strings.Contains(got, "hidden") {
+		t.Errorf("Expected info record to be filtered, got %s", got)
+	}
+	// Loggers created before Configure use the new format.
+	if !strings.Contains(got, `"component":"rib"`) || !strings.Contains(got, `"prefix":"10.0.0.0/24"`) {
+		t.Errorf("Expected JSON record with component and prefix, got %s", got)
+	}
+
+	if err := ConfigureOutput(&b, config.LogConfig{Level: "verbose"}); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+	if err := ConfigureOutput(&b, config.LogConfig{Format: "xml"}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestTraceRoute(t *testing.T) {
+	var b strings.Builder
+	if err := ConfigureOutput(&b, config.LogConfig{Level: "debug", RouteSampleRate: 10}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	logger := For("fib")
+	for i := 0; i < 100; i++ {
+		TraceRoute(logger, "route event")
+	}
+	if n := strings.Count(b.String(), "route event"); n != 10 {
+		t.Errorf("Expected 10 sampled events, got %d", n)
+	}
+}
@@ -0,0 +1,349 @@
+// Package metrics provides a minimal metrics registry rendered in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default is the registry used by the simulator components.
+var Default = NewRegistry()
+
+// metric is implemented by every metric kind held in a Registry.
+type metric interface {
+	// write renders the samples of the metric, without HELP and TYPE lines.
+	// labels holds the rendered labels of a family child, e.g. `a="b"`, or
+	// is empty.
+	write(w io.Writer, name, labels string) error
+}
+
+type entry struct {
+	help   string
+	kind   string
+	metric metric
+}
+
+// Registry holds a set of named metrics.
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]*entry)}
+}
+
+// register returns the metric registered under name, creating it with
+// create if it does not exist yet. Registering the same name with a
+// different kind panics, as it is a programming error.
+func (r *Registry) register(name, help, kind string, create func() metric) metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[name]; ok {
+		if e.kind != kind {
+			panic(fmt.Sprintf("metrics: %s registered as %s and %s", name, e.kind, kind))
+		}
+		return e.metric
+	}
+	m := create()
+	r.entries[name] = &entry{help: help, kind: kind, metric: m}
+	return m
+}
+
+// Counter returns the counter registered under name, creating it if needed.
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.register(name, help, "counter", func() metric { return &Counter{} }).(*Counter)
+}
+
+// CounterVec returns the labelled counter family registered under name,
+// creating it if needed.
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	return r.register(name, help, "counter", func() metric {
+		return &CounterVec{vec: newVec(labels, func() metric { return &Counter{} })}
+	}).(*CounterVec)
+}
+
+// Gauge returns the gauge registered under name, creating it if needed.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.register(name, help, "gauge", func() metric { return &Gauge{} }).(*Gauge)
+}
+
+// GaugeVec returns the labelled gauge family registered under name,
+// creating it if needed.
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	return r.register(name, help, "gauge", func() metric {
+		return &GaugeVec{vec: newVec(labels, func() metric { return &Gauge{} })}
+	}).(*GaugeVec)
+}
+
+// GaugeFunc registers a gauge whose value is computed by f at collection
+// time. Registering an existing name keeps the original function.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(name, help, "gauge", func() metric { return gaugeFunc(f) })
+}
+
+// Summary returns the summary registered under name, creating it if needed.
+func (r *Registry) Summary(name, help string) *Summary {
+	return r.register(name, help, "summary", func() metric { return newSummary() }).(*Summary)
+}
+
+// SummaryVec returns the labelled summary family registered under name,
+// creating it if needed.
+func (r *Registry) SummaryVec(name, help string, labels ...string) *SummaryVec {
+	return r.register(name, help, "summary", func() metric {
+		return &SummaryVec{vec: newVec(labels, func() metric { return newSummary() })}
+	}).(*SummaryVec)
+}
+
+// WriteText renders all metrics in the Prometheus text exposition format,
+// sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	entries := make(map[string]*entry, len(r.entries))
+	for name, e := range r.entries {
+		entries[name] = e
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		e := entries[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, e.help, name, e.kind); err != nil {
+			return err
+		}
+		if err := e.metric.write(w, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns an HTTP handler serving the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Value returns the current value.
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+func (c *Counter) write(w io.Writer, name, labels string) error {
+	_, err := fmt.Fprintf(w, "%s%s %d\n", name, braced(labels), c.Value())
+	return err
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds delta to the gauge.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) write(w io.Writer, name, labels string) error {
+	_, err := fmt.Fprintf(w, "%s%s %s\n", name, braced(labels), formatFloat(g.Value()))
+	return err
+}
+
+// gaugeFunc is a gauge whose value is computed when it is collected.
+type gaugeFunc func() float64
+
+func (f gaugeFunc) write(w io.Writer, name, labels string) error {
+	_, err := fmt.Fprintf(w, "%s%s %s\n", name, braced(labels), formatFloat(f()))
+	return err
+}
+
+// GaugeVec is a family of gauges distinguished by label values.
+type GaugeVec struct {
+	*vec
+}
+
+// With returns the gauge for the given label values, in the order the
+// labels were declared. It panics if the child was registered with Func.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values).(*Gauge)
+}
+
+// Func sets the child with the given label values to a gauge computed by f
+// at collection time, replacing any existing child.
+func (v *GaugeVec) Func(f func() float64, values ...string) {
+	v.set(values, gaugeFunc(f))
+}
+
+// CounterVec is a family of counters distinguished by label values.
+type CounterVec struct {
+	*vec
+}
+
+// With returns the counter for the given label values, in the order the
+// labels were declared.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values).(*Counter)
+}
+
+// vec holds the children of a labelled metric family.
+type vec struct {
+	labels   []string
+	create   func() metric
+	mu       sync.RWMutex
+	children map[string]metric
+	values   map[string][]string
+}
+
+func newVec(labels []string, create func() metric) *vec {
+	return &vec{
+		labels:   labels,
+		create:   create,
+		children: make(map[string]metric),
+		values:   make(map[string][]string),
+	}
+}
+
+func (v *vec) with(values []string) metric {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	m, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return m
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if m, ok := v.children[key]; ok {
+		return m
+	}
+	m = v.create()
+	v.children[key] = m
+	v.values[key] = append([]string(nil), values...)
+	return m
+}
+
+// set replaces the child with the given label values by m.
+func (v *vec) set(values []string, m metric) {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.children[key] = m
+	v.values[key] = append([]string(nil), values...)
+}
+
+// Delete removes the child with the given label values.
+func (v *vec) Delete(values ...string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.children, key)
+	delete(v.values, key)
+}
+
+func (v *vec) write(w io.Writer, name, _ string) error {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.mu.RLock()
+		m, ok := v.children[key]
+		values := v.values[key]
+		v.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := m.write(w, name, formatLabels(v.labels, values)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels, values []string) string {
+	var b strings.Builder
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "%s=%q", l, values[i])
+	}
+	return b.String()
+}
+
+// braced wraps non-empty rendered labels in braces.
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return fmt.Sprintf("%g", v)
+}
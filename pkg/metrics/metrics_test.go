@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_events_total", "Events seen.").Add(3)
+	r.Gauge("test_depth", "Queue depth.").Set(1.5)
+	drops := r.CounterVec("test_drops_total", "Drops by reason.", "reason")
+	drops.With("full").Inc()
+	drops.With("closed").Add(2)
+	queues := r.GaugeVec("test_queue_depth", "Queue depth by queue.", "queue")
+	queues.With("a").Set(3)
+	queues.Func(func() float64 { return 7 }, "b")
+	r.GaugeFunc("test_temperature", "Computed value.", func() float64 { return 21 })
+
+	// Registering an existing name returns the same metric.
+	r.Counter("test_events_total", "Events seen.").Inc()
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := `# HELP test_depth Queue depth.
+# TYPE test_depth gauge
+test_depth 1.5
+# HELP test_drops_total Drops by reason.
+# TYPE test_drops_total counter
+test_drops_total{reason="closed"} 2
+test_drops_total{reason="full"} 1
+# HELP test_events_total Events seen.
+# TYPE test_events_total counter
+test_events_total 4
+# HELP test_queue_depth Queue depth by queue.
+# TYPE test_queue_depth gauge
+test_queue_depth{queue="a"} 3
+test_queue_depth{queue="b"} 7
+# HELP test_temperature Computed value.
+# TYPE test_temperature gauge
+test_temperature 21
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	r := NewRegistry()
+	s := r.SummaryVec("test_latency_seconds", "Latency.", "stage").With("rib")
+	for i := 1; i <= 100; i++ {
+		s.Observe(float64(i))
+	}
+
+	snap := s.Snapshot()
+	if snap.Count != 100 || snap.Sum != 5050 {
+		t.Errorf("Expected count 100 and sum 5050, got %d and %g", snap.Count, snap.Sum)
+	}
+	if snap.P50 != 50 || snap.P99 != 99 || snap.Max != 100 {
+		t.Errorf("Unexpected quantiles %+v", snap)
+	}
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds summary
+test_latency_seconds{stage="rib",quantile="0.5"} 50
+test_latency_seconds{stage="rib",quantile="0.99"} 99
+test_latency_seconds{stage="rib",quantile="1"} 100
+test_latency_seconds_sum{stage="rib"} 5050
+test_latency_seconds_count{stage="rib"} 100
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant:\n%s", got, want)
+	}
+}
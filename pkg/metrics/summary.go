@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// summaryWindow is the number of most recent observations a Summary keeps
+// for computing quantiles.
+const summaryWindow = 4096
+
+// Summary tracks the distribution of observed values. Count and sum cover
+// all observations; quantiles cover the most recent summaryWindow.
+type Summary struct {
+	mu     sync.Mutex
+	count  uint64
+	sum    float64
+	window []float64
+	next   int
+}
+
+func newSummary() *Summary {
+	return &Summary{window: make([]float64, 0, summaryWindow)}
+}
+
+// Observe records v.
+func (s *Summary) Observe(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.sum += v
+	if len(s.window) < summaryWindow {
+		s.window = append(s.window, v)
+		return
+	}
+	s.window[s.next] = v
+	s.next = (s.next + 1) % summaryWindow
+}
+
+// SummarySnapshot is the state of a Summary at one point in time.
+type SummarySnapshot struct {
+	Count uint64
+	Sum   float64
+	P50   float64
+	P99   float64
+	Max   float64
+}
+
+// Snapshot returns the current count, sum and quantiles.
+func (s *Summary) Snapshot() SummarySnapshot {
+	s.mu.Lock()
+	snap := SummarySnapshot{Count: s.count, Sum: s.sum}
+	sorted := append([]float64(nil), s.window...)
+	s.mu.Unlock()
+
+	sort.Float64s(sorted)
+	snap.P50 = quantile(sorted, 0.5)
+	snap.P99 = quantile(sorted, 0.99)
+	snap.Max = quantile(sorted, 1)
+	return snap
+}
+
+// quantile returns the q-quantile of sorted using the nearest-rank method,
+// or 0 if sorted is empty.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+func (s *Summary) write(w io.Writer, name, labels string) error {
+	snap := s.Snapshot()
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	// The 1.0 quantile is the maximum.
+	for _, q := range []struct{ q, v float64 }{{0.5, snap.P50}, {0.99, snap.P99}, {1, snap.Max}} {
+		if _, err := fmt.Fprintf(w, "%s{%s%squantile=\"%s\"} %s\n", name, labels, sep, formatFloat(q.q), formatFloat(q.v)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", name, braced(labels), formatFloat(snap.Sum), name, braced(labels), snap.Count)
+	return err
+}
+
+// SummaryVec is a family of summaries distinguished by label values.
+type SummaryVec struct {
+	*vec
+}
+
+// With returns the summary for the given label values, in the order the
+// labels were declared.
+func (v *SummaryVec) With(values ...string) *Summary {
+	return v.with(values).(*Summary)
+}
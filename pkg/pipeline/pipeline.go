@@ -0,0 +1,72 @@
+// Package pipeline sends updates between the simulator stages and measures
+// the backpressure they exert on each other.
+//
+// Stages are connected by bounded channels. When a channel is full its
+// sender waits until the receiving stage catches up; the time spent waiting
+// and the number of senders currently waiting are exported per channel.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+)
+
+var (
+	sendWait = metrics.Default.SummaryVec("aftsim_channel_send_wait_seconds",
+		"Time senders waited for space on a full pipeline channel, by channel.", "channel")
+	blockedSenders = metrics.Default.GaugeVec("aftsim_channel_blocked_senders",
+		"Senders currently waiting for space on a full pipeline channel, by channel.", "channel")
+)
+
+// Send sends v on ch, waiting for space if ch is full. channel names ch in
+// the backpressure metrics.
+func Send[T any](ch chan<- T, v T, channel string) {
+	SendContext(context.Background(), ch, v, channel)
+}
+
+// SendContext is like Send but gives up when ctx is canceled, returning the
+// context's error.
+func SendContext[T any](ctx context.Context, ch chan<- T, v T, channel string) error {
+	select {
+	case ch <- v:
+		return nil
+	default:
+	}
+
+	blocked := blockedSenders.With(channel)
+	blocked.Add(1)
+	defer blocked.Add(-1)
+	start := time.Now()
+	defer func() { sendWait.With(channel).Observe(time.Since(start).Seconds()) }()
+
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reservePoll is how often Reserve checks a channel for room.
+const reservePoll = time.Millisecond
+
+// Reserve waits until ch has room for n more values, giving up when ctx is
+// canceled. It fails at once if n exceeds the capacity of ch. A channel
+// cannot set room aside, so other senders may still take it before the
+// values are sent with Send; they are then delayed, but never fail.
+func Reserve[T any](ctx context.Context, ch chan<- T, n int) error {
+	if n > cap(ch) {
+		return fmt.Errorf("%d values exceed the channel capacity of %d", n, cap(ch))
+	}
+	for cap(ch)-len(ch) < n {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reservePoll):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSend_Backpressure(t *testing.T) {
+	waits := sendWait.With("test").Snapshot().Count
+	ch := make(chan int, 1)
+	Send(ch, 1, "test")
+	if got := sendWait.With("test").Snapshot().Count - waits; got != 0 {
+		t.Errorf("Expected no wait while channel has space, got %d", got)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		Send(ch, 2, "test")
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for blockedSenders.With("test").Value() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Sender not reported as blocked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	<-ch
+	<-done
+	if got := blockedSenders.With("test").Value(); got != 0 {
+		t.Errorf("Expected no blocked senders, got %v", got)
+	}
+	if got := sendWait.With("test").Snapshot().Count - waits; got != 1 {
+		t.Errorf("Expected 1 wait recorded, got %d", got)
+	}
+	if v := <-ch; v != 2 {
+		t.Errorf("Expected 2, got %d", v)
+	}
+}
+
+func TestSendContext_Canceled(t *testing.T) {
+	ch := make(chan int)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := SendContext(ctx, ch, 1, "canceled"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ch := make(chan int, 2)
+	if err := Reserve(context.Background(), ch, 3); err == nil {
+		t.Error("Expected an error beyond the channel capacity")
+	}
+	ch <- 1
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Reserve(ctx, ch, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	if err := Reserve(context.Background(), ch, 2); err != nil {
+		t.Errorf("Reserve failed: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Package policy evaluates route policies, which filter and modify routes
+// as they enter the RIB (import) and as best paths leave it for the FIB
+// (export).
+//
+// A policy is an ordered list of statements. The first statement whose
+// conditions all match a route decides: it applies its modifications and
+// accepts the route, or rejects it. A route matched by no statement is
+// accepted unchanged.
+package policy
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/openconfig/aft-simulator/pkg/config"
+)
+
+// Route holds the properties of a route that policies match and modify.
+type Route struct {
+	Prefix    netip.Prefix
+	Protocol  string
+	NextHop   netip.Addr
+	Metric    uint32
+	AdminDist uint8
+	Tag       uint32
+}
+
+// Set holds the compiled policies of a configuration and where they apply.
+// A nil *Set applies no policy.
+type Set struct {
+	imports map[string]*Policy
+	export  *Policy
+}
+
+// New compiles the policies of cfg, which must have passed
+// config.Validate. It reports every malformed prefix range.
+func New(cfg config.PolicyConfig) (*Set, error) {
+	var errs []error
+	lists := make(map[string][]prefixRange)
+	for _, name := range slices.Sorted(maps.Keys(cfg.PrefixLists)) {
+		for i, entry := range cfg.PrefixLists[name] {
+			r, err := parsePrefixRange(entry)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("policy.prefix_lists.%s[%d]: %w", name, i, err))
+				continue
+			}
+			lists[name] = append(lists[name], r)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]*Policy)
+	for name, statements := range cfg.Definitions {
+		p := &Policy{Name: name}
+		for _, st := range statements {
+			s := statement{
+				prefixList:   st.PrefixList != "",
+				prefixes:     lists[st.PrefixList],
+				protocols:    st.Protocols,
+				metric:       st.Metric,
+				tag:          st.Tag,
+				reject:       st.Action == "reject",
+				setMetric:    st.SetMetric,
+				setAdminDist: st.SetAdminDistance,
+			}
+			if st.SetNextHop != "" {
+				s.setNextHop, _ = netip.ParseAddr(st.SetNextHop)
+			}
+			p.statements = append(p.statements, s)
+		}
+		policies[name] = p
+	}
+
+	s := &Set{imports: make(map[string]*Policy), export: policies[cfg.Export]}
+	for installer, name := range cfg.Import {
+		s.imports[installer] = policies[name]
+	}
+	return s, nil
+}
+
+// Import returns the policy applied to the routes of installer, or nil.
+func (s *Set) Import(installer string) *Policy {
+	if s == nil {
+		return nil
+	}
+	return s.imports[installer]
+}
+
+// Export returns the policy applied to best paths sent to the FIB, or nil.
+func (s *Set) Export() *Policy {
+	if s == nil {
+		return nil
+	}
+	return s.export
+}
+
+// Policy is a compiled route policy. A nil *Policy accepts every route.
+type Policy struct {
+	Name       string
+	statements []statement
+}
+
+// Apply evaluates p for r, returning the route as modified by the matching
+// statement and whether it is accepted.
+func (p *Policy) Apply(r Route) (Route, bool) {
+	if p == nil {
+		return r, true
+	}
+	for _, s := range p.statements {
+		if !s.matches(r) {
+			continue
+		}
+		if s.reject {
+			return r, false
+		}
+		if s.setMetric != nil {
+			r.Metric = *s.setMetric
+		}
+		if s.setAdminDist != nil {
+			r.AdminDist = *s.setAdminDist
+		}
+		if s.setNextHop.IsValid() {
+			r.NextHop = s.setNextHop
+		}
+		return r, true
+	}
+	return r, true
+}
+
+// statement is a compiled config.PolicyStatement.
+type statement struct {
+	// prefixList reports whether the statement matches on prefixes, which
+	// may then be empty and match nothing.
+	prefixList   bool
+	prefixes     []prefixRange
+	protocols    []string
+	metric       *uint32
+	tag          *uint32
+	reject       bool
+	setMetric    *uint32
+	setAdminDist *uint8
+	setNextHop   netip.Addr
+}
+
+func (s *statement) matches(r Route) bool {
+	if s.prefixList && !slices.ContainsFunc(s.prefixes, func(pr prefixRange) bool { return pr.contains(r.Prefix) }) {
+		return false
+	}
+	if len(s.protocols) > 0 && !slices.ContainsFunc(s.protocols, func(p string) bool { return strings.EqualFold(p, r.Protocol) }) {
+		return false
+	}
+	if s.metric != nil && *s.metric != r.Metric {
+		return false
+	}
+	if s.tag != nil && *s.tag != r.Tag {
+		return false
+	}
+	return true
+}
+
+// prefixRange matches the prefixes within base whose length is between min
+// and max.
+type prefixRange struct {
+	base     netip.Prefix
+	min, max int
+}
+
+func (pr prefixRange) contains(p netip.Prefix) bool {
+	return p.Addr().Is4() == pr.base.Addr().Is4() && p.Bits() >= pr.min && p.Bits() <= pr.max &&
+		pr.base.Contains(p.Addr())
+}
+
+// parsePrefixRange parses a prefix range such as "10.0.0.0/8",
+// "10.0.0.0/8 le 24" or "10.0.0.0/8 ge 16 le 24".
+func parsePrefixRange(s string) (prefixRange, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields)%2 == 0 {
+		return prefixRange{}, fmt.Errorf("invalid prefix range %q", s)
+	}
+	base, err := netip.ParsePrefix(fields[0])
+	if err != nil {
+		return prefixRange{}, err
+	}
+	base = base.Masked()
+	r := prefixRange{base: base, min: base.Bits(), max: base.Bits()}
+	var ge, le int
+	for i := 1; i < len(fields); i += 2 {
+		n, err := strconv.Atoi(fields[i+1])
+		if err != nil || n < base.Bits() || n > base.Addr().BitLen() {
+			return prefixRange{}, fmt.Errorf("invalid prefix length %q in %q", fields[i+1], s)
+		}
+		switch fields[i] {
+		case "ge":
+			ge = n
+		case "le":
+			le = n
+		default:
+			return prefixRange{}, fmt.Errorf("invalid prefix range %q, want ge or le", s)
+		}
+	}
+	if ge != 0 || le != 0 {
+		r.min = cmp.Or(ge, base.Bits())
+		r.max = cmp.Or(le, base.Addr().BitLen())
+	}
+	if r.min > r.max {
+		return prefixRange{}, fmt.Errorf("invalid prefix range %q, ge exceeds le", s)
+	}
+	return r, nil
+}
@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestPolicy_Apply(t *testing.T) {
+	set, err := New(config.PolicyConfig{
+		PrefixLists: map[string][]string{
+			"private": {"10.0.0.0/8 le 24", "192.168.0.0/16 ge 24 le 32"},
+			"empty":   {},
+		},
+		Definitions: map[string][]config.PolicyStatement{
+			"import": {
+				{PrefixList: "empty", Action: "reject"},
+				{Protocols: []string{"static"}, Tag: ptr[uint32](7), Action: "reject"},
+				{PrefixList: "private", Metric: ptr[uint32](10), SetMetric: ptr[uint32](20), SetAdminDistance: ptr[uint8](5)},
+				{PrefixList: "private", SetNextHop: "192.0.2.1"},
+				{Action: "reject"},
+			},
+		},
+		Import: map[string]string{"mock": "import"},
+		Export: "import",
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	p := set.Import("mock")
+	if p == nil || set.Export() != p || set.Import("gnmi") != nil {
+		t.Fatalf("Unexpected attachments %+v", set)
+	}
+
+	nh := netip.MustParseAddr("192.168.1.1")
+	route := func(prefix string, metric, tag uint32) Route {
+		return Route{Prefix: netip.MustParsePrefix(prefix), Protocol: api.ProtocolStatic, NextHop: nh, Metric: metric, AdminDist: 1, Tag: tag}
+	}
+	for _, tc := range []struct {
+		route  Route
+		want   Route
+		accept bool
+	}{
+		{route("10.1.0.0/16", 10, 7), route("10.1.0.0/16", 10, 7), false},
+		{route("10.1.0.0/16", 10, 0), Route{Prefix: netip.MustParsePrefix("10.1.0.0/16"), Protocol: api.ProtocolStatic, NextHop: nh, Metric: 20, AdminDist: 5}, true},
+		{route("10.1.0.0/16", 11, 0), Route{Prefix: netip.MustParsePrefix("10.1.0.0/16"), Protocol: api.ProtocolStatic, NextHop: netip.MustParseAddr("192.0.2.1"), Metric: 11, AdminDist: 1}, true},
+		{route("10.1.1.0/25", 10, 0), route("10.1.1.0/25", 10, 0), false},
+		{route("192.168.0.0/16", 10, 0), route("192.168.0.0/16", 10, 0), false},
+		{route("192.168.1.0/24", 11, 0), Route{Prefix: netip.MustParsePrefix("192.168.1.0/24"), Protocol: api.ProtocolStatic, NextHop: netip.MustParseAddr("192.0.2.1"), Metric: 11, AdminDist: 1}, true},
+	} {
+		got, accept := p.Apply(tc.route)
+		if accept != tc.accept || got != tc.want {
+			t.Errorf("Apply(%+v) = %+v, %t, want %+v, %t", tc.route, got, accept, tc.want, tc.accept)
+		}
+	}
+
+	// Without a policy, routes are accepted unchanged.
+	r := route("8.8.8.0/24", 1, 0)
+	if got, accept := set.Import("gnmi").Apply(r); !accept || got != r {
+		t.Errorf("Expected nil policy to accept %+v, got %+v, %t", r, got, accept)
+	}
+	var none *Set
+	if none.Import("mock") != nil || none.Export() != nil {
+		t.Errorf("Expected nil set to apply no policy")
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New(config.PolicyConfig{PrefixLists: map[string][]string{
+		"bad": {"10.0.0.0/8", "10.0.0.0", "10.0.0.0/8 le", "10.0.0.0/8 ge 4", "10.0.0.0/8 ge 24 le 16", "10.0.0.0/8 eq 24"},
+	}})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{
+		"policy.prefix_lists.bad[1]", "policy.prefix_lists.bad[2]", "policy.prefix_lists.bad[3]",
+		"policy.prefix_lists.bad[4]", "policy.prefix_lists.bad[5]",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error about %s, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "bad[0]") {
+		t.Errorf("Unexpected error about a valid range: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package rib
+
+import (
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+)
+
+// aggregateAdminDist is the admin distance of aggregate routes.
+const aggregateAdminDist = 200
+
+// Aggregate is a summary route the RIB originates while at least one more
+// specific prefix has a selected best path.
+type Aggregate struct {
+	Prefix netip.Prefix
+	// NextHop is the next hop of the aggregate route. If unset, the route
+	// discards traffic (api.NextHopDrop).
+	NextHop netip.Addr
+	// SummaryOnly keeps the more-specific routes out of the FIB while the
+	// aggregate is originated.
+	SummaryOnly bool
+}
+
+// aggregate is the state of a configured Aggregate.
+type aggregate struct {
+	Aggregate
+	// contributors counts the more-specific prefixes with a best path, over
+	// all shards.
+	contributors atomic.Int64
+	// active is set while the aggregate route is originated. It is changed
+	// with the owning shard locked.
+	active atomic.Bool
+	// retired is set once the aggregate is no longer configured.
+	retired atomic.Bool
+}
+
+// covers reports whether prefix is more specific than the aggregate.
+func (a *aggregate) covers(prefix netip.Prefix) bool {
+	return prefix.Bits() > a.Prefix.Bits() && a.Prefix.Contains(prefix.Addr())
+}
+
+// route returns the update originating or withdrawing the aggregate route.
+func (a *aggregate) route(action api.ActionType, ts time.Time) api.RIBUpdate {
+	update := api.RIBUpdate{
+		Action:    action,
+		Protocol:  api.ProtocolAggregate,
+		Prefix:    a.Prefix,
+		NextHop:   a.NextHop,
+		AdminDist: aggregateAdminDist,
+		Timestamp: ts,
+	}
+	if !a.NextHop.IsValid() {
+		update.NextHopType = api.NextHopDrop
+	}
+	return update
+}
+
+// aggregateSet is the configuration of aggregates shared by all shards.
+type aggregateSet []*aggregate
+
+// SetAggregates replaces the configured aggregates. An aggregate route is
+// originated, with protocol api.ProtocolAggregate, while at least one more
+// specific prefix has a selected best path, and withdrawn when the last one
+// loses it. Contributors may be suppressed or rejected by the export policy;
+// aggregates can contribute to less specific aggregates.
+func (r *RIB) SetAggregates(aggregates []Aggregate) {
+	set := make(aggregateSet, 0, len(aggregates))
+	for _, a := range aggregates {
+		a.Prefix = a.Prefix.Masked()
+		set = append(set, &aggregate{Aggregate: a})
+	}
+
+	ts := time.Now()
+	var prev aggregateSet
+	for _, s := range r.shards {
+		prev = s.setAggregates(set)
+	}
+	// Withdraw the previous aggregates first, in case the new set
+	// originates the same prefixes.
+	for _, a := range prev {
+		a.retired.Store(true)
+		r.refreshAggregate(a, ts)
+	}
+	for _, a := range set {
+		r.refreshAggregate(a, ts)
+	}
+}
+
+// refreshAggregate originates or withdraws a according to its current
+// contributors and, for a summary-only aggregate, updates the suppression
+// of the routes it covers. Shards call it after a change made the count of
+// contributors reach or leave zero; since it acts on the count at the time
+// it runs, concurrent refreshes leave the aggregate in the right state.
+func (r *RIB) refreshAggregate(a *aggregate, ts time.Time) {
+	if !r.shardFor(a.Prefix).originate(a, ts) || !a.SummaryOnly {
+		return
+	}
+	for _, s := range r.shards {
+		s.resuppress(a, ts)
+	}
+}
+
+// setAggregates replaces the aggregates of the shard, counting its current
+// contributors, and returns the previous ones.
+func (s *shard) setAggregates(set aggregateSet) aggregateSet {
+	s.lock()
+	defer s.unlock()
+
+	prev := s.aggregates
+	s.aggregates = set
+	for prefix, e := range s.routes.prefixes() {
+		if !e.active {
+			continue
+		}
+		for _, a := range set {
+			if a.covers(prefix) {
+				a.contributors.Add(1)
+			}
+		}
+	}
+	return prev
+}
+
+// contribute adds delta to the contributors of the aggregates covering
+// prefix, queuing a refresh of those that reached or left zero. Must be
+// called with lock held.
+func (s *shard) contribute(prefix netip.Prefix, delta int64) {
+	for _, a := range s.aggregates {
+		if !a.covers(prefix) {
+			continue
+		}
+		if n := a.contributors.Add(delta); (delta > 0 && n == 1) || (delta < 0 && n == 0) {
+			s.refresh = append(s.refresh, a)
+		}
+	}
+}
+
+// suppressed reports whether an originated summary-only aggregate covers
+// prefix. Must be called with lock held.
+func (s *shard) suppressed(prefix netip.Prefix) bool {
+	for _, a := range s.aggregates {
+		if a.SummaryOnly && a.active.Load() && a.covers(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// originate adds or removes the route of a, owned by the shard, reporting
+// whether it changed.
+func (s *shard) originate(a *aggregate, ts time.Time) bool {
+	s.lock()
+	defer s.unlock()
+
+	active := !a.retired.Load() && a.contributors.Load() > 0
+	if active == a.active.Load() {
+		return false
+	}
+	a.active.Store(active)
+	if active {
+		s.add(a.route(api.Add, ts))
+		logging.TraceRoute(logger, "Aggregate originated", "prefix", a.Prefix)
+	} else {
+		s.remove(a.route(api.Delete, ts))
+		logging.TraceRoute(logger, "Aggregate withdrawn", "prefix", a.Prefix)
+	}
+	return true
+}
+
+// resuppress recalculates the best paths of the prefixes covered by a after
+// it was originated or withdrawn.
+func (s *shard) resuppress(a *aggregate, ts time.Time) {
+	s.lock()
+	defer s.unlock()
+
+	for prefix, e := range s.routes.prefixes() {
+		if a.covers(prefix) {
+			s.recalculateBestPath(prefix, e, ts)
+		}
+	}
+}
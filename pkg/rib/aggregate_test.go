@@ -0,0 +1,124 @@
+package rib
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+)
+
+// drain returns the FIB updates queued on fibChan.
+func drain(fibChan chan api.FIBUpdate) []api.FIBUpdate {
+	var updates []api.FIBUpdate
+	for {
+		select {
+		case u := <-fibChan:
+			updates = append(updates, u)
+		default:
+			return updates
+		}
+	}
+}
+
+// expectUpdates checks that got holds the actions on the prefixes or labels
+// of want, in order.
+func expectUpdates(t *testing.T, got []api.FIBUpdate, want ...api.FIBUpdate) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d FIB updates, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Action != w.Action || got[i].Prefix != w.Prefix || got[i].Label != w.Label || got[i].NextHop != w.NextHop ||
+			got[i].NextHopType != w.NextHopType || !slices.Equal(got[i].PushedLabels, w.PushedLabels) {
+			t.Errorf("FIB update %d: got %+v, want %+v", i, got[i], w)
+		}
+	}
+}
+
+func TestRIB_Aggregate(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 100)
+	r := NewSharded(fibChan, 4)
+
+	agg := netip.MustParsePrefix("10.0.0.0/8")
+	p1 := netip.MustParsePrefix("10.1.0.0/16")
+	p2 := netip.MustParsePrefix("10.2.0.0/16")
+	nh := netip.MustParseAddr("192.168.1.1")
+	r.SetAggregates([]Aggregate{{Prefix: agg}})
+	expectUpdates(t, drain(fibChan))
+
+	// The aggregate prefix itself does not contribute.
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: agg, NextHop: nh, AdminDist: 1})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Add, Prefix: agg, NextHop: nh})
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: agg})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Delete, Prefix: agg})
+
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: p1, NextHop: nh})
+	expectUpdates(t, drain(fibChan),
+		api.FIBUpdate{Action: api.Add, Prefix: p1, NextHop: nh},
+		api.FIBUpdate{Action: api.Add, Prefix: agg, NextHopType: api.NextHopDrop})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: p2, NextHop: nh})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Add, Prefix: p2, NextHop: nh})
+
+	state, ok := r.Lookup(agg)
+	if !ok || state.Best == nil || state.Best.Protocol != api.ProtocolAggregate || state.Best.NextHopType != api.NextHopDrop {
+		t.Errorf("Expected a discard aggregate route, got %+v", state)
+	}
+
+	// A contributor without a reachable path no longer counts.
+	r.SetNextHopState(netip.PrefixFrom(nh, 32), false)
+	expectUpdates(t, drain(fibChan),
+		api.FIBUpdate{Action: api.Delete, Prefix: p1},
+		api.FIBUpdate{Action: api.Delete, Prefix: p2},
+		api.FIBUpdate{Action: api.Delete, Prefix: agg})
+	r.SetNextHopState(netip.PrefixFrom(nh, 32), true)
+	if _, ok := r.Lookup(agg); !ok {
+		t.Errorf("Expected the aggregate to be originated again")
+	}
+	drain(fibChan)
+
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: p1})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Delete, Prefix: p1})
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: p2})
+	expectUpdates(t, drain(fibChan),
+		api.FIBUpdate{Action: api.Delete, Prefix: p2},
+		api.FIBUpdate{Action: api.Delete, Prefix: agg})
+	if _, ok := r.Lookup(agg); ok {
+		t.Errorf("Expected the aggregate to be withdrawn")
+	}
+}
+
+func TestRIB_Aggregate_SummaryOnly(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 100)
+	r := NewSharded(fibChan, 4)
+
+	agg := netip.MustParsePrefix("20.0.0.0/8")
+	prefix := netip.MustParsePrefix("20.1.0.0/16")
+	nh := netip.MustParseAddr("192.168.1.1")
+	aggNH := netip.MustParseAddr("192.168.9.9")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh})
+	drain(fibChan)
+
+	// Contributors present before the aggregate is configured count.
+	r.SetAggregates([]Aggregate{{Prefix: agg, NextHop: aggNH, SummaryOnly: true}})
+	expectUpdates(t, drain(fibChan),
+		api.FIBUpdate{Action: api.Add, Prefix: agg, NextHop: aggNH},
+		api.FIBUpdate{Action: api.Delete, Prefix: prefix})
+	state, _ := r.Lookup(prefix)
+	if state.Best == nil || !state.Suppressed {
+		t.Errorf("Expected a suppressed best path, got %+v", state)
+	}
+
+	// Suppressed routes stay out of the FIB as they change.
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.2")})
+	expectUpdates(t, drain(fibChan))
+
+	// Removing the aggregate reinstalls the more-specifics.
+	r.SetAggregates(nil)
+	expectUpdates(t, drain(fibChan),
+		api.FIBUpdate{Action: api.Delete, Prefix: agg},
+		api.FIBUpdate{Action: api.Add, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.2")})
+	if state, _ := r.Lookup(prefix); state.Suppressed {
+		t.Errorf("Expected no suppression, got %+v", state)
+	}
+}
@@ -0,0 +1,146 @@
+package rib
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+)
+
+// bgpProtocol is the interned api.ProtocolBGP.
+var bgpProtocol, _ = internProtocol(api.ProtocolBGP)
+
+// defaultAttrs are the attributes of BGP paths without any.
+var defaultAttrs = api.BGPAttributes{LocalPref: api.DefaultLocalPref}
+
+// step is a step of best-path selection.
+type step uint8
+
+const (
+	stepNone step = iota
+	stepAdminDist
+	stepMetric
+	// BGP steps, in the order of the decision process.
+	stepLocalPref
+	stepASPathLen
+	stepOrigin
+	stepMED
+	stepEBGP
+	stepIGPMetric
+	stepRouterID
+	stepClusterListLen
+	stepNeighbor
+)
+
+// bgpAttrs returns the attributes of a BGP path. Must be called with lock
+// held.
+func (s *shard) bgpAttrs(p *path) *api.BGPAttributes {
+	if a := s.attrs.attrs[p.attrs]; a != nil {
+		return a
+	}
+	return &defaultAttrs
+}
+
+// compare orders two paths by preference, returning a negative number if a
+// is preferred, a positive one if b is, and zero if they are equally good,
+// together with the step that decided.
+//
+// Paths are compared by admin distance first. Two BGP paths are then
+// compared by the BGP decision process, with the metric of a path as its
+// IGP cost; other paths by their metric. Must be called with lock held.
+func (s *shard) compare(a, b *path) (int, step) {
+	if c := cmp.Compare(a.adminDist, b.adminDist); c != 0 {
+		return c, stepAdminDist
+	}
+	if a.protocol != bgpProtocol || b.protocol != bgpProtocol {
+		return cmp.Compare(a.metric, b.metric), stepMetric
+	}
+
+	x, y := s.bgpAttrs(a), s.bgpAttrs(b)
+	if c := cmp.Compare(y.LocalPref, x.LocalPref); c != 0 {
+		return c, stepLocalPref
+	}
+	if c := cmp.Compare(len(x.ASPath), len(y.ASPath)); c != 0 {
+		return c, stepASPathLen
+	}
+	if c := cmp.Compare(x.Origin, y.Origin); c != 0 {
+		return c, stepOrigin
+	}
+	// MED is only comparable between paths from the same neighboring AS.
+	if neighborAS(x) == neighborAS(y) {
+		if c := cmp.Compare(x.MED, y.MED); c != 0 {
+			return c, stepMED
+		}
+	}
+	if x.EBGP != y.EBGP {
+		if x.EBGP {
+			return -1, stepEBGP
+		}
+		return 1, stepEBGP
+	}
+	if c := cmp.Compare(a.metric, b.metric); c != 0 {
+		return c, stepIGPMetric
+	}
+	if c := routerID(x).Compare(routerID(y)); c != 0 {
+		return c, stepRouterID
+	}
+	if c := cmp.Compare(len(x.ClusterList), len(y.ClusterList)); c != 0 {
+		return c, stepClusterListLen
+	}
+	if c := x.Neighbor.Compare(y.Neighbor); c != 0 {
+		return c, stepNeighbor
+	}
+	return 0, stepNone
+}
+
+// neighborAS returns the AS a path was received from, or 0 for paths
+// originated in the local AS.
+func neighborAS(a *api.BGPAttributes) uint32 {
+	if len(a.ASPath) == 0 {
+		return 0
+	}
+	return a.ASPath[0]
+}
+
+// routerID returns the identifier used to break ties between paths: the
+// originator ID of reflected paths, otherwise the neighbor address, as the
+// simulator does not model peer router IDs.
+func routerID(a *api.BGPAttributes) netip.Addr {
+	if a.OriginatorID.IsValid() {
+		return a.OriginatorID
+	}
+	return a.Neighbor
+}
+
+// explain describes why the reachable path loser is not preferred over the
+// best path. Must be called with lock held.
+func (s *shard) explain(loser, best *path) string {
+	_, st := s.compare(loser, best)
+	x, y := s.bgpAttrs(loser), s.bgpAttrs(best)
+	switch st {
+	case stepAdminDist:
+		return fmt.Sprintf("higher admin distance (%d vs %d)", loser.adminDist, best.adminDist)
+	case stepMetric:
+		return fmt.Sprintf("higher metric (%d vs %d)", loser.metric, best.metric)
+	case stepLocalPref:
+		return fmt.Sprintf("lower local preference (%d vs %d)", x.LocalPref, y.LocalPref)
+	case stepASPathLen:
+		return fmt.Sprintf("longer AS path (%d vs %d)", len(x.ASPath), len(y.ASPath))
+	case stepOrigin:
+		return fmt.Sprintf("worse origin (%s vs %s)", x.Origin, y.Origin)
+	case stepMED:
+		return fmt.Sprintf("higher MED (%d vs %d)", x.MED, y.MED)
+	case stepEBGP:
+		return "iBGP path, best path is eBGP"
+	case stepIGPMetric:
+		return fmt.Sprintf("higher IGP metric (%d vs %d)", loser.metric, best.metric)
+	case stepRouterID:
+		return fmt.Sprintf("higher router ID (%s vs %s)", routerID(x), routerID(y))
+	case stepClusterListLen:
+		return fmt.Sprintf("longer cluster list (%d vs %d)", len(x.ClusterList), len(y.ClusterList))
+	case stepNeighbor:
+		return fmt.Sprintf("higher neighbor address (%s vs %s)", x.Neighbor, y.Neighbor)
+	}
+	return "equal to the best path, which was added earlier"
+}
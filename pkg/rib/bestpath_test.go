@@ -0,0 +1,200 @@
+package rib
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+)
+
+func TestRIB_BGPBestPath(t *testing.T) {
+	peer1 := netip.MustParseAddr("10.255.0.1")
+	peer2 := netip.MustParseAddr("10.255.0.2")
+
+	for _, tc := range []struct {
+		name string
+		// better is preferred over worse for the given reason.
+		better, worse api.RIBUpdate
+		reason        string
+	}{
+		{
+			name:   "admin distance",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, AdminDist: 20},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, AdminDist: 200, BGP: &api.BGPAttributes{LocalPref: 500}},
+			reason: "higher admin distance (200 vs 20)",
+		},
+		{
+			name:   "local preference",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 200, ASPath: []uint32{1, 2, 3}}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP},
+			reason: "lower local preference (100 vs 200)",
+		},
+		{
+			name:   "AS path length",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, ASPath: []uint32{1}, Origin: api.OriginIncomplete}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, ASPath: []uint32{2, 1}}},
+			reason: "longer AS path (2 vs 1)",
+		},
+		{
+			name:   "origin",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, Origin: api.OriginIGP, MED: 50}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, Origin: api.OriginEGP}},
+			reason: "worse origin (EGP vs IGP)",
+		},
+		{
+			name:   "MED from the same AS",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, ASPath: []uint32{65001}, MED: 10}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, ASPath: []uint32{65001}, MED: 20, EBGP: true}},
+			reason: "higher MED (20 vs 10)",
+		},
+		{
+			name:   "MED ignored across ASes",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, ASPath: []uint32{65001}, MED: 20, EBGP: true}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, ASPath: []uint32{65002}, MED: 10}},
+			reason: "iBGP path, best path is eBGP",
+		},
+		{
+			name:   "IGP metric",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, Metric: 5, BGP: &api.BGPAttributes{LocalPref: 100, Neighbor: peer2}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, Metric: 10, BGP: &api.BGPAttributes{LocalPref: 100, Neighbor: peer1}},
+			reason: "higher IGP metric (10 vs 5)",
+		},
+		{
+			name:   "originator ID",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, OriginatorID: peer1, Neighbor: peer2}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, OriginatorID: peer2, Neighbor: peer1}},
+			reason: "higher router ID (10.255.0.2 vs 10.255.0.1)",
+		},
+		{
+			name:   "cluster list length",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, OriginatorID: peer1, Neighbor: peer2}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, OriginatorID: peer1, ClusterList: []netip.Addr{peer2}, Neighbor: peer1}},
+			reason: "longer cluster list (1 vs 0)",
+		},
+		{
+			name:   "neighbor address",
+			better: api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, OriginatorID: peer1, Neighbor: peer1}},
+			worse:  api.RIBUpdate{Protocol: api.ProtocolBGP, BGP: &api.BGPAttributes{LocalPref: 100, OriginatorID: peer1, Neighbor: peer2}},
+			reason: "higher neighbor address (10.255.0.2 vs 10.255.0.1)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newShard(new(RIB))
+			better, worse := testPath(s, tc.better), testPath(s, tc.worse)
+			if c, _ := s.compare(better, worse); c >= 0 {
+				t.Errorf("compare(better, worse) = %d, want < 0", c)
+			}
+			if c, _ := s.compare(worse, better); c <= 0 {
+				t.Errorf("compare(worse, better) = %d, want > 0", c)
+			}
+			if got := s.explain(worse, better); got != tc.reason {
+				t.Errorf("explain() = %q, want %q", got, tc.reason)
+			}
+		})
+	}
+}
+
+// testPath stores the path of u in s.
+func testPath(s *shard, u api.RIBUpdate) *path {
+	nh, _ := s.nextHops.acquire(nextHopKey{addr: u.NextHop})
+	proto, _ := internProtocol(u.Protocol)
+	return &path{
+		nextHop:   nh,
+		attrs:     s.attrs.acquire(u.BGP),
+		metric:    u.Metric,
+		protocol:  proto,
+		adminDist: u.AdminDist,
+	}
+}
+
+func TestRIB_Lookup_Reasons(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("61.0.0.0/24")
+	nhStatic := netip.MustParseAddr("192.168.1.1")
+	nhBGP := netip.MustParseAddr("192.168.1.2")
+	nhOSPF := netip.MustParseAddr("192.168.1.3")
+	attrs := &api.BGPAttributes{LocalPref: 200, ASPath: []uint32{65001}, Neighbor: netip.MustParseAddr("10.255.0.1")}
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nhStatic, AdminDist: 1})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolBGP, Prefix: prefix, NextHop: nhBGP, AdminDist: 20, BGP: attrs})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: nhOSPF, AdminDist: 110})
+	r.SetNextHopState(netip.PrefixFrom(nhOSPF, 32), false)
+	// The attributes are copied into the RIB.
+	attrs.LocalPref = 0
+
+	state, ok := r.Lookup(prefix)
+	if !ok {
+		t.Fatalf("Lookup(%s) found nothing", prefix)
+	}
+	want := []string{"", "higher admin distance (20 vs 1)", "next hop unreachable"}
+	if len(state.Candidates) != len(want) {
+		t.Fatalf("Expected %d candidates, got %+v", len(want), state.Candidates)
+	}
+	for i, cand := range state.Candidates {
+		if cand.Reason != want[i] {
+			t.Errorf("Candidate %s: got reason %q, want %q", cand.Protocol, cand.Reason, want[i])
+		}
+	}
+	if bgp := state.Candidates[1].BGP; bgp == nil || bgp.LocalPref != 200 || bgp.ASPath[0] != 65001 {
+		t.Errorf("Expected BGP attributes of the BGP candidate, got %+v", bgp)
+	}
+	if state.Best == nil || state.Best.Protocol != api.ProtocolStatic {
+		t.Errorf("Expected static best path, got %+v", state.Best)
+	}
+}
+
+func TestRIB_MultiplePathsPerProtocol(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("62.0.0.0/24")
+	peer1 := netip.MustParseAddr("10.255.0.1")
+	peer2 := netip.MustParseAddr("10.255.0.2")
+	nh1 := netip.MustParseAddr("192.168.1.1")
+	nh2 := netip.MustParseAddr("192.168.1.2")
+	nh3 := netip.MustParseAddr("192.168.1.3")
+	bgp := func(source string, pathID uint32, nh netip.Addr, localPref uint32) api.RIBUpdate {
+		return api.RIBUpdate{
+			Protocol: api.ProtocolBGP, Source: source, PathID: pathID, Prefix: prefix, NextHop: nh, AdminDist: 20,
+			BGP: &api.BGPAttributes{LocalPref: localPref, ASPath: []uint32{65001}, Neighbor: peer1},
+		}
+	}
+	r.AddRoute(bgp(peer1.String(), 0, nh1, 100))
+	if u := <-fibChan; u.NextHop != nh1 {
+		t.Fatalf("Expected first path via %s, got %+v", nh1, u)
+	}
+	r.AddRoute(bgp(peer2.String(), 0, nh2, 200))
+	if u := <-fibChan; u.NextHop != nh2 {
+		t.Fatalf("Expected higher local preference path via %s, got %+v", nh2, u)
+	}
+	// A second path of the same peer, as with add-path, does not replace
+	// the first.
+	r.AddRoute(bgp(peer2.String(), 1, nh3, 50))
+
+	state, _ := r.Lookup(prefix)
+	if len(state.Candidates) != 3 {
+		t.Fatalf("Expected 3 candidates, got %+v", state.Candidates)
+	}
+	if c := state.Candidates[2]; c.Source != peer2.String() || c.PathID != 1 || c.Reason != "lower local preference (50 vs 200)" {
+		t.Errorf("Unexpected add-path candidate %+v", c)
+	}
+
+	// Withdrawing an unknown path or a path of another source changes
+	// nothing.
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolBGP, Source: "10.255.0.9", Prefix: prefix})
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolBGP, Source: peer2.String(), PathID: 7, Prefix: prefix})
+	if state, _ := r.Lookup(prefix); len(state.Candidates) != 3 {
+		t.Fatalf("Expected 3 candidates after unknown withdrawals, got %+v", state.Candidates)
+	}
+
+	// Withdrawing the best path promotes the first peer's path.
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolBGP, Source: peer2.String(), Prefix: prefix})
+	if u := <-fibChan; u.Action != api.Add || u.NextHop != nh1 {
+		t.Fatalf("Expected promotion to %s, got %+v", nh1, u)
+	}
+	state, _ = r.Lookup(prefix)
+	if len(state.Candidates) != 2 || state.Best == nil || state.Best.Source != peer1.String() {
+		t.Errorf("Expected 2 candidates with %s best, got %+v", peer1, state)
+	}
+}
@@ -0,0 +1,159 @@
+package rib
+
+import (
+	"slices"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+)
+
+// labelPath is a path of an MPLS label entry. Like a route, it is
+// identified by its protocol, source and path ID.
+type labelPath struct {
+	source    uint32
+	pathID    uint32
+	nextHop   uint32
+	metric    uint32
+	protocol  protocolID
+	adminDist uint8
+}
+
+// labelEntry holds the paths of an incoming label, in the order they were
+// added.
+type labelEntry struct {
+	paths []labelPath
+	// installed is the next-hop ID last sent to the FIB, or 0 if the label
+	// is not installed. It holds a reference to the next hop.
+	installed uint32
+}
+
+// addLabel adds or updates a path of the label entry of update.Label. Must
+// be called with lock held.
+func (s *shard) addLabel(update api.RIBUpdate) {
+	proto, ok := internProtocol(update.Protocol)
+	if !ok {
+		logger.Warn("Too many protocol names, label path rejected", "label", update.Label, "protocol", update.Protocol)
+		return
+	}
+	newPath := labelPath{
+		source:    s.sources.acquire(update.Source),
+		pathID:    update.PathID,
+		nextHop:   s.acquireNextHop(updateNextHop(update)),
+		metric:    update.Metric,
+		protocol:  proto,
+		adminDist: update.AdminDist,
+	}
+
+	e := s.labels[update.Label]
+	if e == nil {
+		e = &labelEntry{}
+		s.labels[update.Label] = e
+	}
+	if i := slices.IndexFunc(e.paths, newPath.same); i >= 0 {
+		s.releaseLabelPath(e.paths[i])
+		e.paths[i] = newPath
+	} else {
+		e.paths = append(e.paths, newPath)
+	}
+	s.recalculateLabel(update.Label, e, update.Timestamp)
+}
+
+// removeLabel removes the path of update from the label entry of
+// update.Label. Must be called with lock held.
+func (s *shard) removeLabel(update api.RIBUpdate) {
+	e := s.labels[update.Label]
+	if e == nil {
+		return
+	}
+	source, ok := s.sources.lookup(update.Source)
+	if !ok {
+		return
+	}
+	proto, ok := internProtocol(update.Protocol)
+	if !ok {
+		return
+	}
+	key := labelPath{source: source, pathID: update.PathID, protocol: proto}
+	i := slices.IndexFunc(e.paths, key.same)
+	if i < 0 {
+		return
+	}
+	s.releaseLabelPath(e.paths[i])
+	e.paths = slices.Delete(e.paths, i, i+1)
+
+	s.recalculateLabel(update.Label, e, update.Timestamp)
+	if len(e.paths) == 0 {
+		delete(s.labels, update.Label)
+	}
+}
+
+// same reports whether p and q have the same identity.
+func (p labelPath) same(q labelPath) bool {
+	return p.protocol == q.protocol && p.source == q.source && p.pathID == q.pathID
+}
+
+// releaseLabelPath drops the references held by p. Must be called with lock
+// held.
+func (s *shard) releaseLabelPath(p labelPath) {
+	s.nextHops.release(p.nextHop)
+	s.sources.release(p.source)
+}
+
+// recalculateLabel selects the best path of label, whose entry is e, and
+// updates the FIB if the selected next hop changed. The best path is the
+// reachable one with the lowest admin distance, then metric; of equally
+// good paths, the one added first wins. ts is the time of the change that
+// triggered the recalculation. Must be called with lock held.
+func (s *shard) recalculateLabel(label uint32, e *labelEntry, ts time.Time) {
+	var best *labelPath
+	for i, p := range e.paths {
+		if !s.nextHops.up[p.nextHop] {
+			continue
+		}
+		if best == nil || p.adminDist < best.adminDist || (p.adminDist == best.adminDist && p.metric < best.metric) {
+			best = &e.paths[i]
+		}
+	}
+
+	var nh uint32
+	if best != nil {
+		nh = best.nextHop
+	}
+	if nh == e.installed {
+		if !s.rib.settings.resendUnchanged.Load() {
+			return
+		}
+	} else {
+		if nh != 0 {
+			s.nextHops.hold(nh)
+		}
+		if e.installed != 0 {
+			s.nextHops.release(e.installed)
+		}
+		e.installed = nh
+	}
+
+	if best == nil {
+		s.emit(api.FIBUpdate{
+			Action:    api.Delete,
+			Label:     label,
+			Timestamp: ts,
+		})
+		logging.TraceRoute(logger, "No reachable path", "label", label)
+		return
+	}
+
+	key := s.nextHops.keys[nh]
+	s.emit(api.FIBUpdate{
+		Action:       api.Add,
+		Label:        label,
+		NextHop:      key.addr,
+		NextHopType:  key.typ,
+		Interface:    key.iface,
+		PushedLabels: key.pushed(),
+		Timestamp:    ts,
+	})
+	logging.TraceRoute(logger, "Best path selected", "label", label, "next_hop", api.NextHopString(key.typ, key.addr, key.iface, key.pushed()),
+		"protocol", lookupProtocol(best.protocol).name, "admin_distance", best.adminDist, "metric", best.metric)
+}
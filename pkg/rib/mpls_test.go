@@ -0,0 +1,46 @@
+package rib
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+)
+
+func TestRIB_LabelEntry(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 100)
+	r := NewSharded(fibChan, 4)
+
+	nh1 := netip.MustParseAddr("192.168.1.1")
+	nh2 := netip.MustParseAddr("192.168.2.1")
+	swap := api.LabelStack{16002}
+
+	// A static path swapping the label, and a less preferred one popping it.
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Label: 16001, NextHop: nh1, PushedLabels: swap, AdminDist: 1})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Label: 16001, NextHop: nh2, AdminDist: 110})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Add, Label: 16001, NextHop: nh1, PushedLabels: swap})
+
+	// Label entries are independent of routes via the same next hop.
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: netip.MustParsePrefix("10.0.0.0/8"), NextHop: nh1})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/8"), NextHop: nh1})
+
+	// The label follows the reachability of its next hops.
+	r.SetNextHopState(netip.PrefixFrom(nh1, 32), false)
+	expectUpdates(t, drain(fibChan),
+		api.FIBUpdate{Action: api.Delete, Prefix: netip.MustParsePrefix("10.0.0.0/8")},
+		api.FIBUpdate{Action: api.Add, Label: 16001, NextHop: nh2})
+	r.SetNextHopState(netip.PrefixFrom(nh1, 32), true)
+	expectUpdates(t, drain(fibChan),
+		api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/8"), NextHop: nh1},
+		api.FIBUpdate{Action: api.Add, Label: 16001, NextHop: nh1, PushedLabels: swap})
+
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Label: 16001})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Add, Label: 16001, NextHop: nh2})
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Label: 16001})
+	expectUpdates(t, drain(fibChan), api.FIBUpdate{Action: api.Delete, Label: 16001})
+
+	s := r.shards[r.shardOf(api.RIBUpdate{Label: 16001})]
+	if len(s.labels) != 0 {
+		t.Errorf("Expected no label entries, got %d", len(s.labels))
+	}
+}
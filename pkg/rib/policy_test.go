@@ -0,0 +1,117 @@
+package rib
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/policy"
+)
+
+func newPolicies(t *testing.T, cfg config.PolicyConfig) *policy.Set {
+	t.Helper()
+	set, err := policy.New(cfg)
+	if err != nil {
+		t.Fatalf("policy.New failed: %v", err)
+	}
+	return set
+}
+
+func TestRIB_ImportPolicy(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := NewSharded(fibChan, 1)
+	metric := uint32(5)
+	r.SetPolicies(newPolicies(t, config.PolicyConfig{
+		PrefixLists: map[string][]string{"blocked": {"70.0.0.0/8 le 32"}},
+		Definitions: map[string][]config.PolicyStatement{
+			"in": {
+				{PrefixList: "blocked", Action: "reject"},
+				{SetMetric: &metric, SetNextHop: "192.0.2.1"},
+			},
+		},
+		Import: map[string]string{"mock": "in"},
+	}))
+
+	blocked := netip.MustParsePrefix("70.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolMock, Installer: "mock", Prefix: blocked, NextHop: nh, Metric: 10, AdminDist: 200})
+	select {
+	case u := <-fibChan:
+		t.Fatalf("Expected rejected route not to be installed, got %+v", u)
+	default:
+	}
+	state, ok := r.Lookup(blocked)
+	if !ok || len(state.Candidates) != 1 || !state.Candidates[0].Filtered || state.Best != nil ||
+		state.Candidates[0].Reason != "rejected by import policy" {
+		t.Errorf("Expected a filtered candidate, got %+v", state)
+	}
+
+	// Routes of other installers are not affected.
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Installer: "gnmi", Prefix: blocked, NextHop: nh, AdminDist: 1})
+	if u := <-fibChan; u.NextHop != nh {
+		t.Fatalf("Expected static route via %s, got %+v", nh, u)
+	}
+
+	prefix := netip.MustParsePrefix("71.0.0.0/24")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolMock, Installer: "mock", Prefix: prefix, NextHop: nh, Metric: 10})
+	if u := <-fibChan; u.NextHop != netip.MustParseAddr("192.0.2.1") {
+		t.Fatalf("Expected the policy next hop, got %+v", u)
+	}
+	if state, _ := r.Lookup(prefix); state.Best == nil || state.Best.Metric != 5 {
+		t.Errorf("Expected the policy metric, got %+v", state.Best)
+	}
+
+	// Removing the policies restores the routes as received.
+	r.SetPolicies(nil)
+	if u := <-fibChan; u.Prefix != prefix || u.NextHop != nh {
+		t.Fatalf("Expected %s via %s, got %+v", prefix, nh, u)
+	}
+	if state, _ := r.Lookup(prefix); state.Best == nil || state.Best.Metric != 10 {
+		t.Errorf("Expected the received metric, got %+v", state.Best)
+	}
+	state, _ = r.Lookup(blocked)
+	if len(state.Candidates) != 2 || state.Candidates[0].Filtered || state.Best == nil || state.Best.Protocol != api.ProtocolStatic {
+		t.Errorf("Expected unfiltered candidates, got %+v", state)
+	}
+
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolMock, Prefix: prefix})
+	<-fibChan
+	if n := len(r.shards[0].received); n != 0 {
+		t.Errorf("Expected no received paths left, got %d", n)
+	}
+}
+
+func TestRIB_ExportPolicy(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("72.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh, Tag: 100})
+	<-fibChan
+
+	tag := uint32(100)
+	r.SetPolicies(newPolicies(t, config.PolicyConfig{
+		Definitions: map[string][]config.PolicyStatement{"out": {{Tag: &tag, Action: "reject"}}},
+		Export:      "out",
+	}))
+	if u := <-fibChan; u.Action != api.Delete || u.Prefix != prefix {
+		t.Fatalf("Expected withdrawal of %s, got %+v", prefix, u)
+	}
+	state, _ := r.Lookup(prefix)
+	if state.Best == nil || !state.ExportFiltered || state.Candidates[0].Filtered {
+		t.Errorf("Expected an export-filtered best path, got %+v", state)
+	}
+
+	r.SetPolicies(newPolicies(t, config.PolicyConfig{
+		Definitions: map[string][]config.PolicyStatement{"out": {{Tag: &tag, SetNextHop: "192.0.2.1"}}},
+		Export:      "out",
+	}))
+	if u := <-fibChan; u.Action != api.Add || u.NextHop != netip.MustParseAddr("192.0.2.1") {
+		t.Fatalf("Expected the export next hop, got %+v", u)
+	}
+	if state, _ := r.Lookup(prefix); state.Best == nil || state.Best.NextHop != nh || state.ExportFiltered {
+		t.Errorf("Expected the RIB to keep the received next hop, got %+v", state)
+	}
+}
@@ -2,39 +2,218 @@ package rib
 
 import (
 	"context"
-	"fmt"
+	"encoding/binary"
 	"net/netip"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+	"github.com/openconfig/aft-simulator/pkg/pipeline"
+	"github.com/openconfig/aft-simulator/pkg/policy"
+	"golang.org/x/sync/errgroup"
 )
 
-// RouteEntry represents a single route from a specific protocol.
+var logger = logging.For("rib")
+
+var ribRoutes = metrics.Default.GaugeVec("aftsim_rib_routes",
+	"Routes held in the RIB, by protocol.", "protocol")
+
+// shardQueueSize is the number of updates buffered for each shard worker.
+const shardQueueSize = 1024
+
+// RouteEntry represents a single path to a prefix. It is identified by its
+// Protocol, Source and PathID; see api.RIBUpdate.
 type RouteEntry struct {
-	Protocol  string
-	NextHop   netip.Addr
-	Metric    uint32
-	AdminDist uint8
+	Protocol     string
+	Source       string
+	PathID       uint32
+	NextHop      netip.Addr
+	NextHopType  api.NextHopType
+	Interface    string
+	PushedLabels api.LabelStack
+	Metric       uint32
+	AdminDist    uint8
+	Tag          uint32
+	// BGP holds the attributes of a BGP route, if any. It must not be
+	// modified.
+	BGP *api.BGPAttributes
 }
 
 // RIB maintains the routing table and selects the best path for each prefix.
+//
+// Prefixes are partitioned by hash into shards, each with its own lock and,
+// under Start, its own worker goroutine. All updates of a prefix are handled
+// by the same shard in the order received, so the FIB sees the updates of
+// each prefix in order; updates of different prefixes may be reordered.
 type RIB struct {
-	mu      sync.RWMutex
-	routes  map[netip.Prefix][]RouteEntry
-	fibChan chan<- api.FIBUpdate
+	fibChan  chan<- api.FIBUpdate
+	shards   []*shard
+	settings settings
+
+	// stop is canceled when Start stops, releasing the shards blocked on a
+	// full fibChan.
+	stop   context.Context
+	cancel context.CancelFunc
+	// closeMu guards the closing of fibChan against the sends of shards,
+	// which SetPolicies and SetAggregates may cause after Start returned.
+	closeMu sync.RWMutex
+	closed  bool
 }
 
-// New creates a new RIB.
+// settings are the run-time settings shared by the shards of a RIB.
+type settings struct {
+	// resendUnchanged disables the suppression of unchanged best paths.
+	resendUnchanged atomic.Bool
+	// policies holds the route policies, or nil.
+	policies atomic.Pointer[policy.Set]
+}
+
+// New creates a new RIB with one shard per CPU.
 func New(fibChan chan<- api.FIBUpdate) *RIB {
-	return &RIB{
-		routes:  make(map[netip.Prefix][]RouteEntry),
-		fibChan: fibChan,
+	return NewSharded(fibChan, 0)
+}
+
+// NewSharded creates a new RIB with the given number of shards. Zero or a
+// negative number selects one shard per CPU.
+func NewSharded(fibChan chan<- api.FIBUpdate, shards int) *RIB {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	r := &RIB{fibChan: fibChan}
+	r.stop, r.cancel = context.WithCancel(context.Background())
+	for range shards {
+		r.shards = append(r.shards, newShard(r))
+	}
+	return r
+}
+
+// SetResendUnchanged controls whether the best path of a prefix is sent to
+// the FIB after every change, even if the selected next hop is the one
+// already installed. By default such no-op updates are suppressed; resending
+// them is useful to exercise the FIB and telemetry in tests.
+func (r *RIB) SetResendUnchanged(on bool) {
+	r.settings.resendUnchanged.Store(on)
+}
+
+// SetPolicies replaces the route policies and re-evaluates them for every
+// route. Import policies are selected by the installer of a route (see
+// api.RIBUpdate.Installer) and applied as it is stored: a rejected route
+// stays in the RIB as a filtered candidate but is never selected, and the
+// modifications of an accepted route are used for best-path selection. The
+// export policy is applied to the best path of each prefix before it is sent
+// to the FIB: a rejected best path is not installed and only the next hop it
+// sets affects the FIB entry. A nil set applies no policy.
+func (r *RIB) SetPolicies(p *policy.Set) {
+	r.settings.policies.Store(p)
+	ts := time.Now()
+	for _, s := range r.shards {
+		s.applyPolicies(ts)
 	}
 }
 
-// Start listens for updates on the input channel and processes them.
+// shardOf returns the index of the shard owning the prefix or, for a label
+// entry, the label of update.
+func (r *RIB) shardOf(update api.RIBUpdate) int {
+	if update.Label != 0 {
+		return int(update.Label % uint32(len(r.shards)))
+	}
+	return r.shardIndex(update.Prefix)
+}
+
+// shardFor returns the shard owning prefix.
+func (r *RIB) shardFor(prefix netip.Prefix) *shard {
+	return r.shards[r.shardIndex(prefix)]
+}
+
+// shardIndex returns the index of the shard owning prefix.
+func (r *RIB) shardIndex(prefix netip.Prefix) int {
+	if len(r.shards) == 1 {
+		return 0
+	}
+	a := prefix.Addr().As16()
+	h := binary.BigEndian.Uint64(a[:8])*31 + binary.BigEndian.Uint64(a[8:]) + uint64(prefix.Bits())
+	// Mix the bits so that prefixes differing only in a few octets spread
+	// evenly (the finalizer of MurmurHash3).
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return int(h % uint64(len(r.shards)))
+}
+
+// shardUpdate is an update queued for a shard worker.
+type shardUpdate struct {
+	api.RIBUpdate
+	// remaining counts the shards yet to apply a next-hop state change,
+	// which is queued to every shard. Nil for prefix updates.
+	remaining *atomic.Int32
+}
+
+// Start listens for updates on the input channel and processes them, one
+// worker per shard. Next-hop state changes are applied by every worker, in
+// order with the prefix updates queued before them. A RIB with a single
+// shard processes updates on the calling goroutine. Once ctx is canceled,
+// FIB updates are dropped rather than waiting for a full output channel.
 func (r *RIB) Start(ctx context.Context, inputChan <-chan api.RIBUpdate) error {
-	defer close(r.fibChan)
+	defer r.close()
+	context.AfterFunc(ctx, r.cancel)
+	if len(r.shards) == 1 {
+		return r.dispatch(ctx, inputChan, func(update shardUpdate) error {
+			r.shards[0].handle(update)
+			return nil
+		})
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	queues := make([]chan shardUpdate, len(r.shards))
+	for i, s := range r.shards {
+		queues[i] = make(chan shardUpdate, shardQueueSize)
+		g.Go(func() error { return s.run(ctx, queues[i]) })
+	}
+	g.Go(func() error {
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
+		return r.dispatch(ctx, inputChan, func(update shardUpdate) error {
+			if update.remaining == nil {
+				return pipeline.SendContext(ctx, queues[r.shardOf(update.RIBUpdate)], update, "rib_shard")
+			}
+			for _, queue := range queues {
+				if err := pipeline.SendContext(ctx, queue, update, "rib_shard"); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return g.Wait()
+}
+
+// send sends update to the FIB, waiting while its channel is full. It
+// reports false, dropping update, once Start stopped.
+func (r *RIB) send(update api.FIBUpdate) bool {
+	r.closeMu.RLock()
+	defer r.closeMu.RUnlock()
+	return !r.closed && pipeline.SendContext(r.stop, r.fibChan, update, "fib") == nil
+}
+
+// close stops the sends to the FIB and closes its channel.
+func (r *RIB) close() {
+	r.cancel()
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+	r.closed = true
+	close(r.fibChan)
+}
+
+// dispatch passes the updates received on inputChan to handle until the
+// channel is closed, ctx is canceled or handle fails.
+func (r *RIB) dispatch(ctx context.Context, inputChan <-chan api.RIBUpdate, handle func(shardUpdate) error) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -43,107 +222,85 @@ func (r *RIB) Start(ctx context.Context, inputChan <-chan api.RIBUpdate) error {
 			if !ok {
 				return nil
 			}
-			switch update.Action {
-			case api.Add:
-				r.AddRoute(update)
-			case api.Delete:
-				r.DeleteRoute(update)
+			if update.Timestamp.IsZero() {
+				update.Timestamp = time.Now()
+			}
+			su := shardUpdate{RIBUpdate: update}
+			if update.Action == api.NextHopDown || update.Action == api.NextHopUp {
+				su.remaining = new(atomic.Int32)
+				su.remaining.Store(int32(len(r.shards)))
+			}
+			if err := handle(su); err != nil {
+				return err
 			}
 		}
 	}
 }
 
-// AddRoute adds or updates a route in the RIB.
+// AddRoute adds a route to the RIB or replaces the route with the same
+// protocol, source and path ID.
+//
+// An update with a Label adds a path of the MPLS label entry of that label
+// instead. The best path of a label entry is the reachable one with the
+// lowest admin distance, then metric; policies and aggregates do not apply
+// to label entries.
 func (r *RIB) AddRoute(update api.RIBUpdate) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	entries, exists := r.routes[update.Prefix]
-	if !exists {
-		entries = []RouteEntry{}
-	}
-
-	newEntry := RouteEntry{
-		Protocol:  update.Protocol,
-		NextHop:   update.NextHop,
-		Metric:    update.Metric,
-		AdminDist: update.AdminDist,
-	}
-
-	// Check if we are updating an existing entry for the same protocol
-	updated := false
-	for i, entry := range entries {
-		if entry.Protocol == update.Protocol {
-			entries[i] = newEntry
-			updated = true
-			break
-		}
-	}
-	if !updated {
-		entries = append(entries, newEntry)
-	}
-	r.routes[update.Prefix] = entries
-
-	r.recalculateBestPath(update.Prefix)
+	r.shards[r.shardOf(update)].addRoute(update)
 }
 
-// DeleteRoute removes a route from the RIB.
+// DeleteRoute removes the route, or label entry path, with the protocol,
+// source and path ID of update from the RIB.
 func (r *RIB) DeleteRoute(update api.RIBUpdate) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	entries, exists := r.routes[update.Prefix]
-	if !exists {
-		return
-	}
+	r.shards[r.shardOf(update)].deleteRoute(update)
+}
 
-	newEntries := []RouteEntry{}
-	for _, entry := range entries {
-		if entry.Protocol != update.Protocol {
-			newEntries = append(newEntries, entry)
-		}
+// SetNextHopState marks all next hops contained in nhRange as reachable (up)
+// or unreachable (down) and recomputes the best path of every affected prefix.
+func (r *RIB) SetNextHopState(nhRange netip.Prefix, up bool) {
+	ts := time.Now()
+	for _, s := range r.shards {
+		s.setNextHopState(nhRange, up, ts)
 	}
+}
 
-	if len(newEntries) == 0 {
-		delete(r.routes, update.Prefix)
-		// Notify FIB of removal
-		r.fibChan <- api.FIBUpdate{
-			Action: api.Delete,
-			Prefix: update.Prefix,
-		}
-		return
+// SetInterfaceState marks the interface next hops of iface as reachable
+// (up) or unreachable (down) and recomputes the best path of every affected
+// prefix.
+func (r *RIB) SetInterfaceState(iface string, up bool) {
+	ts := time.Now()
+	for _, s := range r.shards {
+		s.setInterfaceState(iface, up, ts)
 	}
-
-	r.routes[update.Prefix] = newEntries
-	r.recalculateBestPath(update.Prefix)
 }
 
-// recalculateBestPath determines the best route and updates the FIB if necessary.
-// Must be called with lock held.
-func (r *RIB) recalculateBestPath(prefix netip.Prefix) {
-	entries := r.routes[prefix]
-	if len(entries) == 0 {
-		return
-	}
+// Candidate is a route of a prefix together with the reachability of its
+// next hop.
+type Candidate struct {
+	RouteEntry
+	Reachable bool
+	// Filtered is set if the import policy rejected the route.
+	Filtered bool
+	// Reason explains why the candidate is not the best path, e.g.
+	// "lower local preference (100 vs 200)". It is empty for the best path.
+	Reason string
+}
 
-	best := entries[0]
-	for _, entry := range entries[1:] {
-		if entry.AdminDist < best.AdminDist {
-			best = entry
-		} else if entry.AdminDist == best.AdminDist {
-			if entry.Metric < best.Metric {
-				best = entry
-			}
-		}
-	}
+// PrefixState is the RIB state of one prefix.
+type PrefixState struct {
+	Prefix     netip.Prefix
+	Candidates []Candidate
+	// Best is the selected route, or nil if no candidate is reachable.
+	Best *RouteEntry
+	// ExportFiltered is set if the export policy keeps Best out of the FIB.
+	ExportFiltered bool
+	// Suppressed is set if a summary-only aggregate keeps Best out of the
+	// FIB.
+	Suppressed bool
+}
 
-	// For now, always send update. Optimization: Check against current FIB state if we stored it.
-	// Since we don't store FIB state in RIB, we rely on FIB to handle no-op updates or
-	// we just send it. Sending it is safer to ensure consistency.
-	r.fibChan <- api.FIBUpdate{
-		Action:  api.Add,
-		Prefix:  prefix,
-		NextHop: best.NextHop,
-	}
-	fmt.Printf("RIB: Best path for %s is via %s (Proto: %s, AD: %d, Metric: %d)\n", prefix, best.NextHop, best.Protocol, best.AdminDist, best.Metric)
+// Lookup returns the candidate routes of prefix and the selected best path.
+// It returns false if the RIB holds no route for prefix.
+func (r *RIB) Lookup(prefix netip.Prefix) (PrefixState, bool) {
+	prefix = prefix.Masked()
+	return r.shardFor(prefix).lookup(prefix)
 }
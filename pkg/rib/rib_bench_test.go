@@ -0,0 +1,96 @@
+package rib
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+)
+
+// BenchmarkRIB_Start measures the ingestion throughput of Start. With one
+// shard every update is handled by the goroutine reading the input channel,
+// as before sharding; more shards only help with as many CPUs available.
+func BenchmarkRIB_Start(b *testing.B) {
+	const prefixes = 1 << 16
+	updates := make([]api.RIBUpdate, prefixes)
+	for i := range updates {
+		updates[i] = api.RIBUpdate{
+			Action:    api.Add,
+			Protocol:  api.ProtocolStatic,
+			Prefix:    netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i >> 8), byte(i), 0}), 24),
+			NextHop:   netip.AddrFrom4([4]byte{192, 168, 1, byte(i%4 + 1)}),
+			Metric:    uint32(i % 10),
+			AdminDist: 1,
+		}
+	}
+
+	for _, shards := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			ribChan := make(chan api.RIBUpdate, 10000)
+			fibChan := make(chan api.FIBUpdate, 10000)
+			r := NewSharded(fibChan, shards)
+			done := make(chan struct{})
+			go func() {
+				for range fibChan {
+				}
+				close(done)
+			}()
+			errc := make(chan error, 1)
+			go func() { errc <- r.Start(context.Background(), ribChan) }()
+
+			b.ResetTimer()
+			for i := range b.N {
+				ribChan <- updates[i%prefixes]
+			}
+			close(ribChan)
+			if err := <-errc; err != nil {
+				b.Fatal(err)
+			}
+			<-done
+		})
+	}
+}
+
+// BenchmarkRIB_Memory reports the heap used per route of a RIB holding one
+// route for each of 1M and 5M prefixes.
+func BenchmarkRIB_Memory(b *testing.B) {
+	for _, prefixes := range []int{1_000_000, 5_000_000} {
+		b.Run(fmt.Sprintf("prefixes=%d", prefixes), func(b *testing.B) {
+			for range b.N {
+				fibChan := make(chan api.FIBUpdate, 10000)
+				go func() {
+					for range fibChan {
+					}
+				}()
+				before := heapAlloc()
+				r := NewSharded(fibChan, 1)
+				for i := range prefixes {
+					// Distinct /24s starting at 1.0.0.0.
+					a := uint32(1<<24 + i<<8)
+					r.AddRoute(api.RIBUpdate{
+						Action:    api.Add,
+						Protocol:  api.ProtocolStatic,
+						Prefix:    netip.PrefixFrom(netip.AddrFrom4([4]byte{byte(a >> 24), byte(a >> 16), byte(a >> 8), 0}), 24),
+						NextHop:   netip.AddrFrom4([4]byte{192, 168, 1, byte(i%4 + 1)}),
+						Metric:    10,
+						AdminDist: 1,
+					})
+				}
+				b.ReportMetric(float64(heapAlloc()-before)/float64(prefixes), "B/route")
+				runtime.KeepAlive(r)
+				close(fibChan)
+			}
+		})
+	}
+}
+
+// heapAlloc returns the bytes of live heap objects after a full collection.
+func heapAlloc() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
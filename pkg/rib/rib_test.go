@@ -1,6 +1,7 @@
 package rib
 
 import (
+	"context"
 	"net/netip"
 	"testing"
 	"time"
@@ -77,9 +78,11 @@ func TestRIB_DeleteRoute_PromoteNextBest(t *testing.T) {
 	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nhStatic, AdminDist: 1})
 	<-fibChan // Consume
 
-	// Add OSPF (Backup)
+	// Add OSPF (Backup) - the best path is unchanged, so nothing is sent.
 	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: nhOSPF, AdminDist: 110})
-	<-fibChan // Consume (or ignore if optimized)
+	if len(fibChan) != 0 {
+		t.Errorf("Expected no update for a backup path, got %+v", <-fibChan)
+	}
 
 	// Delete Static
 	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix})
@@ -116,3 +119,297 @@ func TestRIB_DeleteAllRoutes(t *testing.T) {
 		t.Fatal("Timeout waiting for FIB delete")
 	}
 }
+
+func TestRIB_SetNextHopState(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("40.0.0.0/24")
+	nhStatic := netip.MustParseAddr("192.168.1.1")
+	nhOSPF := netip.MustParseAddr("192.168.2.1")
+
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nhStatic, AdminDist: 1})
+	<-fibChan
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: nhOSPF, AdminDist: 110})
+
+	// Taking down the static next hop promotes the OSPF path.
+	r.SetNextHopState(netip.MustParsePrefix("192.168.1.1/32"), false)
+	if update := <-fibChan; update.Action != api.Add || update.NextHop != nhOSPF {
+		t.Errorf("Expected ADD via %s, got %+v", nhOSPF, update)
+	}
+
+	// Taking down the subnet of the OSPF next hop leaves no reachable path.
+	r.SetNextHopState(netip.MustParsePrefix("192.168.2.0/24"), false)
+	if update := <-fibChan; update.Action != api.Delete || update.Prefix != prefix {
+		t.Errorf("Expected DELETE %s, got %+v", prefix, update)
+	}
+
+	// Restoring the static next hop reinstalls it.
+	r.SetNextHopState(netip.MustParsePrefix("192.168.1.1/32"), true)
+	if update := <-fibChan; update.Action != api.Add || update.NextHop != nhStatic {
+		t.Errorf("Expected ADD via %s, got %+v", nhStatic, update)
+	}
+}
+
+func TestRIB_SetInterfaceState(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("41.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHopType: api.NextHopInterface, Interface: "eth0", AdminDist: 1})
+	<-fibChan
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: nh, AdminDist: 110})
+
+	// Address ranges do not cover interface next hops.
+	r.SetNextHopState(netip.MustParsePrefix("0.0.0.0/0"), false)
+	r.SetNextHopState(netip.MustParsePrefix("0.0.0.0/0"), true)
+
+	// Taking down the interface promotes the OSPF path.
+	r.SetInterfaceState("eth0", false)
+	if update := <-fibChan; update.Action != api.Add || update.NextHop != nh {
+		t.Errorf("Expected ADD via %s, got %+v", nh, update)
+	}
+	r.SetInterfaceState("eth0", true)
+	if update := <-fibChan; update.Action != api.Add || update.Interface != "eth0" {
+		t.Errorf("Expected ADD via eth0, got %+v", update)
+	}
+	if len(fibChan) != 0 {
+		t.Errorf("Expected no more updates, got %d", len(fibChan))
+	}
+}
+
+func TestRIB_SuppressUnchangedBestPath(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("45.0.0.0/24")
+	nh1 := netip.MustParseAddr("192.168.1.1")
+	nh2 := netip.MustParseAddr("192.168.1.2")
+
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh1, AdminDist: 1})
+	if update := <-fibChan; update.Action != api.Add || update.NextHop != nh1 {
+		t.Fatalf("Expected ADD via %s, got %+v", nh1, update)
+	}
+
+	// None of these change the selected next hop.
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh1, AdminDist: 1})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh1, Metric: 5, AdminDist: 1})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: nh2, AdminDist: 110})
+	r.SetNextHopState(netip.PrefixFrom(nh2, 32), false)
+	r.SetNextHopState(netip.PrefixFrom(nh2, 32), true)
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix})
+	if len(fibChan) != 0 {
+		t.Errorf("Expected no updates for an unchanged best path, got %+v", <-fibChan)
+	}
+
+	// Once unreachable, the prefix is deleted once.
+	r.SetNextHopState(netip.PrefixFrom(nh1, 32), false)
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh1, Metric: 7, AdminDist: 1})
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix})
+	if update := <-fibChan; update.Action != api.Delete {
+		t.Errorf("Expected DELETE, got %+v", update)
+	}
+	if len(fibChan) != 0 {
+		t.Errorf("Expected a single DELETE, got %+v", <-fibChan)
+	}
+}
+
+func TestRIB_SetResendUnchanged(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+	r.SetResendUnchanged(true)
+
+	prefix := netip.MustParsePrefix("46.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh, AdminDist: 1})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh, AdminDist: 1})
+	for range 2 {
+		if update := <-fibChan; update.Action != api.Add || update.NextHop != nh {
+			t.Errorf("Expected ADD via %s, got %+v", nh, update)
+		}
+	}
+}
+
+func TestRIB_Start_Timestamps(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("50.0.0.0/24")
+	ts := time.Unix(1000, 0)
+	ribChan <- api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.1"), Timestamp: ts}
+	// Updates without a timestamp are stamped on arrival.
+	ribChan <- api.RIBUpdate{Action: api.Delete, Protocol: api.ProtocolStatic, Prefix: prefix}
+	close(ribChan)
+	before := time.Now()
+	if err := r.Start(context.Background(), ribChan); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if update := <-fibChan; !update.Timestamp.Equal(ts) {
+		t.Errorf("Expected source timestamp %v, got %v", ts, update.Timestamp)
+	}
+	if update := <-fibChan; update.Timestamp.Before(before) {
+		t.Errorf("Expected arrival timestamp, got %v", update.Timestamp)
+	}
+}
+
+func TestRIB_Start_Sharded(t *testing.T) {
+	const prefixes = 64
+	ribChan := make(chan api.RIBUpdate, 4*prefixes)
+	fibChan := make(chan api.FIBUpdate, 8*prefixes)
+	r := NewSharded(fibChan, 8)
+
+	nh1 := netip.MustParseAddr("192.168.1.1")
+	nh2 := netip.MustParseAddr("192.168.1.2")
+	for i := range prefixes {
+		prefix := netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, byte(i), 0}), 24)
+		ribChan <- api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh1, AdminDist: 1}
+		ribChan <- api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh2, AdminDist: 1}
+	}
+	// Applies to the prefixes of every shard.
+	ribChan <- api.RIBUpdate{Action: api.NextHopDown, Prefix: netip.PrefixFrom(nh2, 32)}
+	close(ribChan)
+	if err := r.Start(context.Background(), ribChan); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	// Each prefix sees its updates in order: nh1, nh2, then the delete.
+	seen := make(map[netip.Prefix][]api.FIBUpdate)
+	for update := range fibChan {
+		seen[update.Prefix] = append(seen[update.Prefix], update)
+	}
+	if len(seen) != prefixes {
+		t.Fatalf("Expected updates for %d prefixes, got %d", prefixes, len(seen))
+	}
+	for prefix, updates := range seen {
+		if len(updates) != 3 || updates[0].NextHop != nh1 || updates[1].NextHop != nh2 || updates[2].Action != api.Delete {
+			t.Errorf("Unexpected updates for %s: %+v", prefix, updates)
+		}
+	}
+}
+
+func TestRIB_Start_StopWithFullFIB(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	fibChan := make(chan api.FIBUpdate, 1)
+	r := NewSharded(fibChan, 2)
+
+	nh := netip.MustParseAddr("192.168.1.1")
+	for i := range 4 {
+		prefix := netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, byte(i), 0}), 24)
+		ribChan <- api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- r.Start(ctx, ribChan) }()
+
+	// Nobody reads the FIB channel, so the shards block once it is full.
+	for len(fibChan) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return with the FIB channel full")
+	}
+
+	// Changes after Start returned are dropped, not sent on the closed
+	// channel.
+	r.AddRoute(api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Prefix: netip.MustParsePrefix("10.9.0.0/16"), NextHop: nh})
+	r.SetPolicies(nil)
+	r.SetAggregates([]Aggregate{{Prefix: netip.MustParsePrefix("10.0.0.0/8")}})
+}
+
+func TestRIB_RouteCountMetric(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+	routes := ribRoutes.With(api.ProtocolOSPF)
+	before := routes.Value()
+
+	prefix := netip.MustParsePrefix("60.0.0.0/24")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.1")})
+	// Replacing the route of the same protocol does not add to the count.
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.2")})
+	if got := routes.Value() - before; got != 1 {
+		t.Errorf("Expected 1 OSPF route, got %g", got)
+	}
+
+	r.DeleteRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix})
+	if got := routes.Value() - before; got != 0 {
+		t.Errorf("Expected 0 OSPF routes after delete, got %g", got)
+	}
+}
+
+func TestRIB_Lookup(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 10)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("70.0.0.0/24")
+	nhStatic := netip.MustParseAddr("192.168.1.1")
+	nhOSPF := netip.MustParseAddr("192.168.2.1")
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nhStatic, AdminDist: 1})
+	r.AddRoute(api.RIBUpdate{Protocol: api.ProtocolOSPF, Prefix: prefix, NextHop: nhOSPF, AdminDist: 110})
+	r.SetNextHopState(netip.MustParsePrefix("192.168.1.0/24"), false)
+
+	state, ok := r.Lookup(prefix)
+	if !ok {
+		t.Fatalf("Expected %s in the RIB", prefix)
+	}
+	if len(state.Candidates) != 2 || state.Candidates[0].Reachable || !state.Candidates[1].Reachable {
+		t.Errorf("Expected unreachable static and reachable OSPF candidates, got %+v", state.Candidates)
+	}
+	if state.Best == nil || state.Best.Protocol != api.ProtocolOSPF {
+		t.Errorf("Expected OSPF best path, got %+v", state.Best)
+	}
+
+	if _, ok := r.Lookup(netip.MustParsePrefix("70.0.1.0/24")); ok {
+		t.Error("Expected unknown prefix to be missing")
+	}
+}
+
+func TestRIB_StalledFIB(t *testing.T) {
+	// An unbuffered channel that nobody reads stalls the RIB on its first
+	// FIB update.
+	fibChan := make(chan api.FIBUpdate)
+	r := New(fibChan)
+
+	prefix := netip.MustParsePrefix("10.0.0.0/24")
+	nh := netip.MustParseAddr("192.168.1.1")
+	go r.AddRoute(api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh, AdminDist: 1})
+
+	// Lookup must not wait for the stalled FIB.
+	deadline := time.After(time.Second)
+	for {
+		lookupDone := make(chan bool)
+		go func() {
+			_, ok := r.Lookup(prefix)
+			lookupDone <- ok
+		}()
+		var ok bool
+		select {
+		case ok = <-lookupDone:
+		case <-deadline:
+			t.Fatal("Lookup blocked by stalled FIB channel")
+		}
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Changes queue behind the stalled one and reach the FIB in order.
+	go r.SetNextHopState(netip.PrefixFrom(nh, 32), false)
+	for _, want := range []api.ActionType{api.Add, api.Delete} {
+		select {
+		case update := <-fibChan:
+			if update.Action != want || update.Prefix != prefix {
+				t.Errorf("Expected %v %s, got %+v", want, prefix, update)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for FIB update %v", want)
+		}
+	}
+}
@@ -0,0 +1,622 @@
+package rib
+
+import (
+	"cmp"
+	"context"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/latency"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/policy"
+)
+
+// shard holds the routes of a subset of the prefixes.
+//
+// Changes are applied under mu, and the resulting FIB updates are sent only
+// after mu is released, so readers are never blocked by a stalled FIB.
+// emitMu serializes changes until their updates are sent, keeping the FIB
+// updates in the order of the changes.
+type shard struct {
+	emitMu   sync.Mutex
+	mu       sync.RWMutex
+	routes   *table
+	nextHops *nextHopTable
+	attrs    *attrTable
+	sources  *sourceTable
+	// received holds the paths modified by the import policy as they were
+	// received, by path index.
+	received map[uint32]received
+	// pending holds the FIB updates of the change in progress.
+	pending []api.FIBUpdate
+
+	// rib is the RIB the shard belongs to.
+	rib *RIB
+
+	// aggregates are the configured aggregates. Each shard counts its own
+	// contributors to them.
+	aggregates aggregateSet
+	// refresh holds the aggregates whose contributors changed between none
+	// and some in the change in progress.
+	refresh []*aggregate
+
+	// labels holds the MPLS label entries, by incoming label.
+	labels map[uint32]*labelEntry
+
+	// downNextHops holds the ranges of next-hop addresses currently marked
+	// unreachable. A next hop is usable only if no range contains it.
+	downNextHops map[netip.Prefix]struct{}
+	// downInterfaces holds the interfaces whose interface next hops are
+	// currently marked unreachable.
+	downInterfaces map[string]struct{}
+}
+
+func newShard(r *RIB) *shard {
+	return &shard{
+		routes:         newTable(),
+		nextHops:       newNextHopTable(),
+		attrs:          newAttrTable(),
+		sources:        newSourceTable(),
+		received:       make(map[uint32]received),
+		rib:            r,
+		labels:         make(map[uint32]*labelEntry),
+		downNextHops:   make(map[netip.Prefix]struct{}),
+		downInterfaces: make(map[string]struct{}),
+	}
+}
+
+// run processes the updates queued for the shard until the queue is closed
+// or ctx is canceled.
+func (s *shard) run(ctx context.Context, queue <-chan shardUpdate) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case update, ok := <-queue:
+			if !ok {
+				return nil
+			}
+			s.handle(update)
+		}
+	}
+}
+
+// handle applies an update received by Start.
+func (s *shard) handle(update shardUpdate) {
+	switch update.Action {
+	case api.Add:
+		s.addRoute(update.RIBUpdate)
+	case api.Delete:
+		s.deleteRoute(update.RIBUpdate)
+	case api.NextHopDown, api.NextHopUp:
+		up := update.Action == api.NextHopUp
+		if update.Interface != "" {
+			s.setInterfaceState(update.Interface, up, update.Timestamp)
+		} else {
+			s.setNextHopState(update.Prefix, up, update.Timestamp)
+		}
+	}
+	// A next-hop state change is handled once every shard applied it.
+	if update.remaining == nil || update.remaining.Add(-1) == 0 {
+		latency.Observe(latency.StageRIB, update.Timestamp)
+	}
+}
+
+// lock acquires the shard for a change.
+func (s *shard) lock() {
+	s.emitMu.Lock()
+	s.mu.Lock()
+}
+
+// unlock releases the shard and then sends the FIB updates of the change,
+// waiting for the FIB if its channel is full. Finally it refreshes the
+// aggregates affected by the change, which may be owned by any shard.
+func (s *shard) unlock() {
+	out := s.pending
+	refresh := s.refresh
+	s.refresh = nil
+	s.mu.Unlock()
+	for _, update := range out {
+		if !s.rib.send(update) {
+			break
+		}
+	}
+	clear(out)
+	s.pending = out[:0]
+	s.emitMu.Unlock()
+	for _, a := range refresh {
+		s.rib.refreshAggregate(a, time.Now())
+	}
+}
+
+// emit queues update for the FIB. Must be called with lock held.
+func (s *shard) emit(update api.FIBUpdate) {
+	s.pending = append(s.pending, update)
+}
+
+// addRoute adds or updates a route or label entry path in the shard.
+func (s *shard) addRoute(update api.RIBUpdate) {
+	s.lock()
+	defer s.unlock()
+	if update.Label != 0 {
+		s.addLabel(update)
+		return
+	}
+	s.add(update)
+}
+
+// deleteRoute removes a route or label entry path from the shard.
+func (s *shard) deleteRoute(update api.RIBUpdate) {
+	s.lock()
+	defer s.unlock()
+	if update.Label != 0 {
+		s.removeLabel(update)
+		return
+	}
+	s.remove(update)
+}
+
+// add implements addRoute. Must be called with lock held.
+func (s *shard) add(update api.RIBUpdate) {
+	proto, ok := internProtocol(update.Protocol)
+	installer, ok2 := internInstaller(update.Installer)
+	if !ok || !ok2 {
+		logger.Warn("Too many protocol or installer names, route rejected", "prefix", update.Prefix,
+			"protocol", update.Protocol, "installer", update.Installer)
+		return
+	}
+	newPath := path{
+		nextHop:   s.acquireNextHop(updateNextHop(update)),
+		attrs:     s.attrs.acquire(update.BGP),
+		source:    s.sources.acquire(update.Source),
+		pathID:    update.PathID,
+		metric:    update.Metric,
+		tag:       update.Tag,
+		protocol:  proto,
+		installer: installer,
+		adminDist: update.AdminDist,
+	}
+
+	// Check if we are updating an existing path with the same identity,
+	// otherwise append a new one.
+	e := s.routes.get(update.Prefix)
+	var last uint32
+	for i, p := range s.routes.list(e.head) {
+		if p.protocol == proto && p.source == newPath.source && p.pathID == newPath.pathID {
+			s.releaseRefs(i)
+			newPath.next = p.next
+			*p = newPath
+			s.applyImport(update.Prefix, i)
+			s.recalculateBestPath(update.Prefix, e, update.Timestamp)
+			return
+		}
+		last = i
+	}
+	i := s.routes.alloc(newPath)
+	if last == 0 {
+		e.head = i
+		s.routes.set(update.Prefix, e)
+	} else {
+		s.routes.paths[last].next = i
+	}
+	lookupProtocol(proto).routes.Add(1)
+	s.applyImport(update.Prefix, i)
+
+	s.recalculateBestPath(update.Prefix, e, update.Timestamp)
+}
+
+// remove implements deleteRoute. Must be called with lock held.
+func (s *shard) remove(update api.RIBUpdate) {
+	e := s.routes.get(update.Prefix)
+	if e.head == 0 {
+		return
+	}
+
+	proto, ok := internProtocol(update.Protocol)
+	if !ok {
+		return
+	}
+	source, ok := s.sources.lookup(update.Source)
+	if !ok {
+		return
+	}
+	var prev uint32
+	for i, p := range s.routes.list(e.head) {
+		if p.protocol != proto || p.source != source || p.pathID != update.PathID {
+			prev = i
+			continue
+		}
+		if prev == 0 {
+			e.head = p.next
+			s.routes.set(update.Prefix, e)
+		} else {
+			s.routes.paths[prev].next = p.next
+		}
+		s.releaseRefs(i)
+		s.routes.release(i)
+		lookupProtocol(proto).routes.Add(-1)
+		break
+	}
+
+	if e.head == 0 {
+		if e.active {
+			s.contribute(update.Prefix, -1)
+		}
+		// Notify FIB of removal
+		if e.installed != 0 {
+			s.nextHops.release(e.installed)
+		}
+		if e.installed != 0 || s.rib.settings.resendUnchanged.Load() {
+			s.emit(api.FIBUpdate{
+				Action:    api.Delete,
+				Prefix:    update.Prefix,
+				Timestamp: update.Timestamp,
+			})
+		}
+		return
+	}
+
+	s.recalculateBestPath(update.Prefix, e, update.Timestamp)
+}
+
+// releaseRefs drops the references held by the path at index i. Must be
+// called with lock held.
+func (s *shard) releaseRefs(i uint32) {
+	p := &s.routes.paths[i]
+	s.nextHops.release(p.nextHop)
+	s.attrs.release(p.attrs)
+	s.sources.release(p.source)
+	if recv, ok := s.received[i]; ok {
+		s.nextHops.release(recv.nextHop)
+		delete(s.received, i)
+	}
+}
+
+// applyImport evaluates the import policy for the path at index i of
+// prefix, starting from the properties the path was received with. Must be
+// called with lock held.
+func (s *shard) applyImport(prefix netip.Prefix, i uint32) {
+	p := &s.routes.paths[i]
+	recv, modified := s.received[i]
+	pol := s.rib.settings.policies.Load().Import(lookupInstaller(p.installer))
+	if pol == nil && !modified {
+		p.filtered = false
+		return
+	}
+	if !modified {
+		recv = received{nextHop: p.nextHop, metric: p.metric, adminDist: p.adminDist}
+	}
+	r, ok := pol.Apply(policy.Route{
+		Prefix:    prefix,
+		Protocol:  lookupProtocol(p.protocol).name,
+		NextHop:   s.nextHops.keys[recv.nextHop].addr,
+		Metric:    recv.metric,
+		AdminDist: recv.adminDist,
+		Tag:       p.tag,
+	})
+	p.filtered = !ok
+
+	// Take the references of the new state before dropping the old ones:
+	// the path holds its next hop, and a received entry the next hop the
+	// path was received with.
+	nh := recv.nextHop
+	if r.NextHop != s.nextHops.keys[nh].addr {
+		nh = s.acquireNextHop(nextHopKey{addr: r.NextHop})
+	} else {
+		s.nextHops.hold(nh)
+	}
+	changed := nh != recv.nextHop || r.Metric != recv.metric || r.AdminDist != recv.adminDist
+	if changed {
+		s.nextHops.hold(recv.nextHop)
+	}
+	s.nextHops.release(p.nextHop)
+	if modified {
+		s.nextHops.release(recv.nextHop)
+	}
+
+	p.nextHop, p.metric, p.adminDist = nh, r.Metric, r.AdminDist
+	if changed {
+		s.received[i] = recv
+	} else {
+		delete(s.received, i)
+	}
+}
+
+// export evaluates the export policy for p, the best path of prefix. It
+// returns the next hop to install and whether the path is accepted. Must be
+// called with lock held.
+func (s *shard) export(prefix netip.Prefix, p *path) (nextHopKey, bool) {
+	nh := s.nextHops.keys[p.nextHop]
+	pol := s.rib.settings.policies.Load().Export()
+	if pol == nil {
+		return nh, true
+	}
+	r, ok := pol.Apply(policy.Route{
+		Prefix:    prefix,
+		Protocol:  lookupProtocol(p.protocol).name,
+		NextHop:   nh.addr,
+		Metric:    p.metric,
+		AdminDist: p.adminDist,
+		Tag:       p.tag,
+	})
+	if r.NextHop != nh.addr {
+		nh = nextHopKey{addr: r.NextHop}
+	}
+	return nh, ok
+}
+
+// applyPolicies re-evaluates the policies for every path after they changed
+// at ts.
+func (s *shard) applyPolicies(ts time.Time) {
+	s.lock()
+	defer s.unlock()
+
+	for prefix, e := range s.routes.prefixes() {
+		for i := range s.routes.list(e.head) {
+			s.applyImport(prefix, i)
+		}
+		s.recalculateBestPath(prefix, e, ts)
+	}
+}
+
+// setNextHopState applies a next-hop state change that happened at ts to
+// the prefixes of the shard.
+func (s *shard) setNextHopState(nhRange netip.Prefix, up bool, ts time.Time) {
+	s.lock()
+	defer s.unlock()
+
+	nhRange = nhRange.Masked()
+	if !setDown(s.downNextHops, nhRange, !up) {
+		return
+	}
+	s.refreshNextHops(func(nh nextHopKey) bool { return nhRange.Contains(nh.addr) }, ts)
+}
+
+// setInterfaceState applies a change of the state of the interface next
+// hops of iface that happened at ts to the prefixes of the shard.
+func (s *shard) setInterfaceState(iface string, up bool, ts time.Time) {
+	s.lock()
+	defer s.unlock()
+
+	if !setDown(s.downInterfaces, iface, !up) {
+		return
+	}
+	s.refreshNextHops(func(nh nextHopKey) bool {
+		return nh.typ == api.NextHopInterface && nh.iface == iface
+	}, ts)
+}
+
+// setDown adds key to or removes it from the down set, reporting whether
+// that changed the set.
+func setDown[K comparable](set map[K]struct{}, key K, down bool) bool {
+	if _, isDown := set[key]; isDown == down {
+		return false
+	}
+	if down {
+		set[key] = struct{}{}
+	} else {
+		delete(set, key)
+	}
+	return true
+}
+
+// refreshNextHops updates the reachability of the next hops for which
+// affects returns true and recalculates the prefixes and label entries
+// using them. Must be called with lock held.
+func (s *shard) refreshNextHops(affects func(nextHopKey) bool, ts time.Time) {
+	nhs := s.nextHops
+	affected := make([]bool, len(nhs.keys))
+	for id, nh := range nhs.keys {
+		if nhs.refs[id] > 0 && affects(nh) {
+			affected[id] = true
+			nhs.up[id] = s.reachable(nh)
+		}
+	}
+	for prefix, e := range s.routes.prefixes() {
+		for _, p := range s.routes.list(e.head) {
+			if affected[p.nextHop] {
+				s.recalculateBestPath(prefix, e, ts)
+				break
+			}
+		}
+	}
+	for label, e := range s.labels {
+		if slices.ContainsFunc(e.paths, func(p labelPath) bool { return affected[p.nextHop] }) {
+			s.recalculateLabel(label, e, ts)
+		}
+	}
+}
+
+// acquireNextHop returns the ID of nh, taking a reference. Must be called
+// with lock held.
+func (s *shard) acquireNextHop(nh nextHopKey) uint32 {
+	id, added := s.nextHops.acquire(nh)
+	if added {
+		s.nextHops.setUp(id, s.reachable(nh))
+	}
+	return id
+}
+
+// updateNextHop returns the next hop of update.
+func updateNextHop(update api.RIBUpdate) nextHopKey {
+	nh := nextHopKey{typ: update.NextHopType, labels: update.PushedLabels.String()}
+	switch update.NextHopType {
+	case api.NextHopIP:
+		nh.addr = update.NextHop
+	case api.NextHopInterface:
+		nh.iface = update.Interface
+	}
+	return nh
+}
+
+// reachable reports whether nh is not covered by any down next-hop range
+// or, for an interface next hop, down interface. Drop and receive next hops
+// are always reachable. Must be called with lock held.
+func (s *shard) reachable(nh nextHopKey) bool {
+	if nh.typ == api.NextHopInterface {
+		_, down := s.downInterfaces[nh.iface]
+		return !down
+	}
+	for nhRange := range s.downNextHops {
+		if nhRange.Contains(nh.addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectBest returns the index of the best reachable path of the list
+// starting at head (see compare), or 0 if no path is reachable. Paths
+// rejected by the import policy are ignored. Of equally good paths, the one
+// added first wins. Must be called with lock held.
+func (s *shard) selectBest(head uint32) uint32 {
+	var best uint32
+	for i, p := range s.routes.list(head) {
+		if p.filtered || !s.nextHops.up[p.nextHop] {
+			continue
+		}
+		if best == 0 {
+			best = i
+			continue
+		}
+		if c, _ := s.compare(p, &s.routes.paths[best]); c < 0 {
+			best = i
+		}
+	}
+	return best
+}
+
+// entry expands a stored path. Must be called with lock held.
+func (s *shard) entry(p *path) RouteEntry {
+	return RouteEntry{
+		Protocol:     lookupProtocol(p.protocol).name,
+		Source:       s.sources.keys[p.source],
+		PathID:       p.pathID,
+		NextHop:      s.nextHops.keys[p.nextHop].addr,
+		NextHopType:  s.nextHops.keys[p.nextHop].typ,
+		Interface:    s.nextHops.keys[p.nextHop].iface,
+		PushedLabels: s.nextHops.keys[p.nextHop].pushed(),
+		Metric:       p.metric,
+		AdminDist:    p.adminDist,
+		Tag:          p.tag,
+		BGP:          s.attrs.attrs[p.attrs],
+	}
+}
+
+// lookup implements RIB.Lookup for a masked prefix of the shard.
+func (s *shard) lookup(prefix netip.Prefix) (PrefixState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	head := s.routes.get(prefix).head
+	if head == 0 {
+		return PrefixState{}, false
+	}
+	state := PrefixState{Prefix: prefix}
+	best := s.selectBest(head)
+	for i, p := range s.routes.list(head) {
+		cand := Candidate{RouteEntry: s.entry(p), Reachable: s.nextHops.up[p.nextHop], Filtered: p.filtered}
+		switch {
+		case i == best:
+			state.Best = &cand.RouteEntry
+			_, ok := s.export(prefix, p)
+			state.ExportFiltered = !ok
+			state.Suppressed = s.suppressed(prefix)
+		case cand.Filtered:
+			cand.Reason = "rejected by import policy"
+		case !cand.Reachable:
+			cand.Reason = "next hop unreachable"
+		default:
+			cand.Reason = s.explain(p, &s.routes.paths[best])
+		}
+		state.Candidates = append(state.Candidates, cand)
+	}
+	return state, true
+}
+
+// recalculateBestPath determines the best route of prefix, whose stored
+// entry is e, and updates the FIB if the selected next hop changed.
+// ts is the time of the change that triggered the recalculation.
+// Must be called with lock held.
+func (s *shard) recalculateBestPath(prefix netip.Prefix, e prefixEntry, ts time.Time) {
+	if e.head == 0 {
+		return
+	}
+
+	best := s.selectBest(e.head)
+	if active := best != 0; active != e.active {
+		e.active = active
+		s.routes.set(prefix, e)
+		if active {
+			s.contribute(prefix, 1)
+		} else {
+			s.contribute(prefix, -1)
+		}
+	}
+
+	// held is set if nh is a next hop set by the export policy, to which a
+	// reference was taken. withdrawn explains why a selected best path is
+	// not installed.
+	var nh uint32
+	var held bool
+	var withdrawn string
+	if best != 0 {
+		p := &s.routes.paths[best]
+		nh = p.nextHop
+		key, ok := s.export(prefix, p)
+		switch {
+		case !ok:
+			best, nh, withdrawn = 0, 0, "Best path rejected by export policy"
+		case s.suppressed(prefix):
+			best, nh, withdrawn = 0, 0, "Best path suppressed by summary-only aggregate"
+		case key != s.nextHops.keys[nh]:
+			nh = s.acquireNextHop(key)
+			held = true
+		}
+	}
+	if nh == e.installed {
+		if held {
+			// The installed next hop already holds a reference.
+			s.nextHops.release(nh)
+		}
+		if !s.rib.settings.resendUnchanged.Load() {
+			return
+		}
+	} else {
+		if nh != 0 && !held {
+			s.nextHops.hold(nh)
+		}
+		if e.installed != 0 {
+			s.nextHops.release(e.installed)
+		}
+		e.installed = nh
+		s.routes.set(prefix, e)
+	}
+
+	if best == 0 {
+		s.emit(api.FIBUpdate{
+			Action:    api.Delete,
+			Prefix:    prefix,
+			Timestamp: ts,
+		})
+		logging.TraceRoute(logger, cmp.Or(withdrawn, "No reachable path"), "prefix", prefix)
+		return
+	}
+
+	p := &s.routes.paths[best]
+	key := s.nextHops.keys[nh]
+	s.emit(api.FIBUpdate{
+		Action:       api.Add,
+		Prefix:       prefix,
+		NextHop:      key.addr,
+		NextHopType:  key.typ,
+		Interface:    key.iface,
+		PushedLabels: key.pushed(),
+		Timestamp:    ts,
+	})
+	logging.TraceRoute(logger, "Best path selected", "prefix", prefix, "next_hop", api.NextHopString(key.typ, key.addr, key.iface, key.pushed()),
+		"protocol", lookupProtocol(p.protocol).name, "admin_distance", p.adminDist, "metric", p.metric)
+}
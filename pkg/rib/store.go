@@ -0,0 +1,465 @@
+package rib
+
+import (
+	"encoding/binary"
+	"iter"
+	"maps"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+)
+
+// protocolID is an interned protocol name.
+type protocolID uint8
+
+// protocol is the registry entry of an interned protocol.
+type protocol struct {
+	name string
+	// routes counts the routes of the protocol held in any RIB.
+	routes *metrics.Gauge
+}
+
+// protocolTable maps protocol names to IDs and back.
+type protocolTable struct {
+	ids   map[string]protocolID
+	names []protocol
+}
+
+// protocols interns protocol names. There are only a handful of them, so
+// entries are never removed, and the table is copied on registration so
+// that lookups need no lock.
+var protocols struct {
+	mu    sync.Mutex
+	table atomic.Pointer[protocolTable]
+}
+
+// internProtocol returns the ID of the protocol name, registering it if
+// needed. It reports false if name is new and every ID is taken.
+func internProtocol(name string) (protocolID, bool) {
+	if t := protocols.table.Load(); t != nil {
+		if id, ok := t.ids[name]; ok {
+			return id, true
+		}
+	}
+
+	protocols.mu.Lock()
+	defer protocols.mu.Unlock()
+	next := &protocolTable{ids: make(map[string]protocolID)}
+	if t := protocols.table.Load(); t != nil {
+		if id, ok := t.ids[name]; ok {
+			return id, true
+		}
+		if len(t.names) > int(^protocolID(0)) {
+			return 0, false
+		}
+		maps.Copy(next.ids, t.ids)
+		next.names = slices.Clone(t.names)
+	}
+	id := protocolID(len(next.names))
+	next.ids[name] = id
+	next.names = append(next.names, protocol{name: name, routes: ribRoutes.With(name)})
+	protocols.table.Store(next)
+	return id, true
+}
+
+// lookupProtocol returns the registry entry of id.
+func lookupProtocol(id protocolID) protocol {
+	return protocols.table.Load().names[id]
+}
+
+// installerID is an interned installer name. ID 0 stands for no installer.
+type installerID uint8
+
+// installers interns installer names. Like protocols, there are only a
+// handful of them and entries are never removed.
+var installers struct {
+	mu    sync.Mutex
+	names atomic.Pointer[[]string]
+}
+
+// internInstaller returns the ID of the installer name, registering it if
+// needed. It reports false if name is new and every ID is taken.
+func internInstaller(name string) (installerID, bool) {
+	if name == "" {
+		return 0, true
+	}
+	if names := installers.names.Load(); names != nil {
+		if i := slices.Index(*names, name); i >= 0 {
+			return installerID(i), true
+		}
+	}
+
+	installers.mu.Lock()
+	defer installers.mu.Unlock()
+	next := []string{""}
+	if names := installers.names.Load(); names != nil {
+		if i := slices.Index(*names, name); i >= 0 {
+			return installerID(i), true
+		}
+		if len(*names) > int(^installerID(0)) {
+			return 0, false
+		}
+		next = slices.Clone(*names)
+	}
+	next = append(next, name)
+	installers.names.Store(&next)
+	return installerID(len(next) - 1), true
+}
+
+// lookupInstaller returns the name of id.
+func lookupInstaller(id installerID) string {
+	if id == 0 {
+		return ""
+	}
+	return (*installers.names.Load())[id]
+}
+
+// path is a stored route. Paths of a prefix form a linked list in the
+// order they were added.
+type path struct {
+	// next is the index of the next path of the prefix, or 0.
+	next      uint32
+	nextHop   uint32 // ID in the shard's next-hop table.
+	attrs     uint32 // ID in the shard's BGP attribute table.
+	source    uint32 // ID in the shard's source table.
+	pathID    uint32
+	metric    uint32
+	tag       uint32
+	protocol  protocolID
+	installer installerID
+	adminDist uint8
+	// filtered is set if the import policy rejected the path.
+	filtered bool
+}
+
+// received holds the properties of a path as received, before the import
+// policy modified them. It holds a reference to its next hop.
+type received struct {
+	nextHop   uint32
+	metric    uint32
+	adminDist uint8
+}
+
+// prefixEntry is the stored state of a prefix.
+type prefixEntry struct {
+	// head is the index of the first path of the prefix.
+	head uint32
+	// installed is the next-hop ID last sent to the FIB, or 0 if the
+	// prefix is not installed. It holds a reference to the next hop.
+	installed uint32
+	// active is set if a best path is selected, which makes the prefix a
+	// contributor to the aggregates covering it.
+	active bool
+}
+
+// table stores the routes of a shard compactly: a map from each prefix to
+// the index of its first path in an arena of paths. IPv4 prefixes, the
+// common case, are keyed by a packed integer instead of a netip.Prefix.
+// Freed paths are reused but the arena never shrinks.
+type table struct {
+	v4 map[uint64]prefixEntry
+	v6 map[netip.Prefix]prefixEntry
+	// paths[0] is unused so that index 0 can end a list.
+	paths []path
+	// free is the first of the freed paths, linked through next.
+	free uint32
+}
+
+func newTable() *table {
+	return &table{
+		v4:    make(map[uint64]prefixEntry),
+		v6:    make(map[netip.Prefix]prefixEntry),
+		paths: make([]path, 1),
+	}
+}
+
+// v4Key packs an IPv4 prefix into an integer.
+func v4Key(prefix netip.Prefix) uint64 {
+	a := prefix.Addr().As4()
+	return uint64(a[0])<<32 | uint64(a[1])<<24 | uint64(a[2])<<16 | uint64(a[3])<<8 | uint64(prefix.Bits())
+}
+
+// v4Prefix unpacks a key made by v4Key.
+func v4Prefix(key uint64) netip.Prefix {
+	a := netip.AddrFrom4([4]byte{byte(key >> 32), byte(key >> 24), byte(key >> 16), byte(key >> 8)})
+	return netip.PrefixFrom(a, int(key&0xff))
+}
+
+// get returns the entry of prefix. Its head is 0 if the table holds no
+// route for prefix.
+func (t *table) get(prefix netip.Prefix) prefixEntry {
+	if prefix.Addr().Is4() {
+		return t.v4[v4Key(prefix)]
+	}
+	return t.v6[prefix]
+}
+
+// set stores the entry of prefix. An entry with a head of 0 removes prefix.
+func (t *table) set(prefix netip.Prefix, e prefixEntry) {
+	switch {
+	case prefix.Addr().Is4() && e.head == 0:
+		delete(t.v4, v4Key(prefix))
+	case prefix.Addr().Is4():
+		t.v4[v4Key(prefix)] = e
+	case e.head == 0:
+		delete(t.v6, prefix)
+	default:
+		t.v6[prefix] = e
+	}
+}
+
+// prefixes iterates over every prefix and its entry.
+func (t *table) prefixes() iter.Seq2[netip.Prefix, prefixEntry] {
+	return func(yield func(netip.Prefix, prefixEntry) bool) {
+		for key, e := range t.v4 {
+			if !yield(v4Prefix(key), e) {
+				return
+			}
+		}
+		for prefix, e := range t.v6 {
+			if !yield(prefix, e) {
+				return
+			}
+		}
+	}
+}
+
+// list iterates over the paths starting at index i.
+func (t *table) list(i uint32) iter.Seq2[uint32, *path] {
+	return func(yield func(uint32, *path) bool) {
+		for ; i != 0; i = t.paths[i].next {
+			if !yield(i, &t.paths[i]) {
+				return
+			}
+		}
+	}
+}
+
+// alloc stores p and returns its index.
+func (t *table) alloc(p path) uint32 {
+	if i := t.free; i != 0 {
+		t.free = t.paths[i].next
+		t.paths[i] = p
+		return i
+	}
+	t.paths = append(t.paths, p)
+	return uint32(len(t.paths) - 1)
+}
+
+// release frees the path at index i.
+func (t *table) release(i uint32) {
+	t.paths[i] = path{next: t.free}
+	t.free = i
+}
+
+// internTable assigns small integer IDs to values shared by many routes,
+// counting references so that IDs are reused once a value is unused.
+type internTable[K comparable] struct {
+	ids map[K]uint32
+	// keys and refs are indexed by ID; ID 0 is unused.
+	keys []K
+	refs []uint32
+	// free lists the released IDs.
+	free []uint32
+}
+
+func newInternTable[K comparable]() internTable[K] {
+	return internTable[K]{
+		ids:  make(map[K]uint32),
+		keys: make([]K, 1),
+		refs: make([]uint32, 1),
+	}
+}
+
+// acquire returns the ID of key, taking a reference. added reports whether
+// key was not interned before.
+func (t *internTable[K]) acquire(key K) (id uint32, added bool) {
+	if id, ok := t.ids[key]; ok {
+		t.refs[id]++
+		return id, false
+	}
+	if n := len(t.free); n > 0 {
+		id = t.free[n-1]
+		t.free = t.free[:n-1]
+		t.keys[id], t.refs[id] = key, 1
+	} else {
+		id = uint32(len(t.keys))
+		t.keys = append(t.keys, key)
+		t.refs = append(t.refs, 1)
+	}
+	t.ids[key] = id
+	return id, true
+}
+
+// hold takes another reference to id.
+func (t *internTable[K]) hold(id uint32) {
+	t.refs[id]++
+}
+
+// release drops a reference to id, forgetting the key with the last one.
+func (t *internTable[K]) release(id uint32) {
+	t.refs[id]--
+	if t.refs[id] > 0 {
+		return
+	}
+	var zero K
+	delete(t.ids, t.keys[id])
+	t.keys[id] = zero
+	t.free = append(t.free, id)
+}
+
+// grow extends a slice indexed by the IDs of t to cover id.
+func grow[V any](s []V, id uint32) []V {
+	if int(id) < len(s) {
+		return s
+	}
+	return append(s, make([]V, int(id)+1-len(s))...)
+}
+
+// nextHopKey identifies a next hop by its type and, for IP next hops,
+// address or, for interface next hops, interface, together with the labels
+// it pushes.
+type nextHopKey struct {
+	addr  netip.Addr
+	typ   api.NextHopType
+	iface string
+	// labels is the pushed label stack, formatted by api.LabelStack.String.
+	labels string
+}
+
+// pushed returns the label stack pushed by k.
+func (k nextHopKey) pushed() api.LabelStack {
+	labels, _ := api.ParseLabelStack(k.labels)
+	return labels
+}
+
+// nextHopTable interns the next hops of a shard and caches their
+// reachability.
+type nextHopTable struct {
+	internTable[nextHopKey]
+	up []bool
+}
+
+func newNextHopTable() *nextHopTable {
+	return &nextHopTable{internTable: newInternTable[nextHopKey](), up: make([]bool, 1)}
+}
+
+// setUp records the reachability of id.
+func (t *nextHopTable) setUp(id uint32, up bool) {
+	t.up = grow(t.up, id)
+	t.up[id] = up
+}
+
+// sourceTable interns the route sources of a shard. ID 0 stands for the
+// empty source.
+type sourceTable struct {
+	internTable[string]
+}
+
+func newSourceTable() *sourceTable {
+	return &sourceTable{internTable: newInternTable[string]()}
+}
+
+// acquire returns the ID of name, taking a reference.
+func (t *sourceTable) acquire(name string) uint32 {
+	if name == "" {
+		return 0
+	}
+	id, _ := t.internTable.acquire(name)
+	return id
+}
+
+// lookup returns the ID of name, reporting whether it is known.
+func (t *sourceTable) lookup(name string) (uint32, bool) {
+	if name == "" {
+		return 0, true
+	}
+	id, ok := t.ids[name]
+	return id, ok
+}
+
+// release drops a reference to id.
+func (t *sourceTable) release(id uint32) {
+	if id != 0 {
+		t.internTable.release(id)
+	}
+}
+
+// attrTable interns the BGP attributes of a shard. ID 0 stands for no
+// attributes.
+type attrTable struct {
+	internTable[string]
+	attrs []*api.BGPAttributes
+}
+
+func newAttrTable() *attrTable {
+	return &attrTable{internTable: newInternTable[string](), attrs: make([]*api.BGPAttributes, 1)}
+}
+
+// acquire returns the ID of a copy of a, taking a reference.
+func (t *attrTable) acquire(a *api.BGPAttributes) uint32 {
+	if a == nil {
+		return 0
+	}
+	id, added := t.internTable.acquire(attrKey(a))
+	if added {
+		c := *a
+		c.ASPath = slices.Clone(a.ASPath)
+		c.Communities = slices.Clone(a.Communities)
+		c.ClusterList = slices.Clone(a.ClusterList)
+		t.attrs = grow(t.attrs, id)
+		t.attrs[id] = &c
+	}
+	return id
+}
+
+// release drops a reference to id.
+func (t *attrTable) release(id uint32) {
+	if id == 0 {
+		return
+	}
+	t.internTable.release(id)
+	if t.refs[id] == 0 {
+		t.attrs[id] = nil
+	}
+}
+
+// attrKey encodes a so that equal attributes have equal keys.
+func attrKey(a *api.BGPAttributes) string {
+	var b []byte
+	b = binary.AppendUvarint(b, uint64(a.LocalPref))
+	b = binary.AppendUvarint(b, uint64(len(a.ASPath)))
+	for _, as := range a.ASPath {
+		b = binary.AppendUvarint(b, uint64(as))
+	}
+	b = append(b, byte(a.Origin))
+	b = binary.AppendUvarint(b, uint64(a.MED))
+	b = binary.AppendUvarint(b, uint64(len(a.Communities)))
+	for _, c := range a.Communities {
+		b = binary.AppendUvarint(b, uint64(len(c)))
+		b = append(b, c...)
+	}
+	if a.EBGP {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = appendAddr(b, a.OriginatorID)
+	b = binary.AppendUvarint(b, uint64(len(a.ClusterList)))
+	for _, addr := range a.ClusterList {
+		b = appendAddr(b, addr)
+	}
+	b = appendAddr(b, a.Neighbor)
+	return string(b)
+}
+
+// appendAddr appends a length-prefixed encoding of addr to b.
+func appendAddr(b []byte, addr netip.Addr) []byte {
+	raw := addr.AsSlice()
+	b = append(b, byte(len(raw)))
+	return append(b, raw...)
+}
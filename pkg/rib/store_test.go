@@ -0,0 +1,129 @@
+package rib
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+)
+
+func TestTable_Keys(t *testing.T) {
+	tbl := newTable()
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/0"),
+		netip.MustParsePrefix("10.1.2.0/24"),
+		netip.MustParsePrefix("255.255.255.255/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	for i, prefix := range prefixes {
+		tbl.set(prefix, prefixEntry{head: uint32(i + 1)})
+	}
+	got := make(map[netip.Prefix]uint32)
+	for prefix, e := range tbl.prefixes() {
+		got[prefix] = e.head
+	}
+	for i, prefix := range prefixes {
+		if got[prefix] != uint32(i+1) || tbl.get(prefix).head != uint32(i+1) {
+			t.Errorf("Expected head %d for %s, got %d", i+1, prefix, got[prefix])
+		}
+	}
+
+	tbl.set(prefixes[1], prefixEntry{})
+	if tbl.get(prefixes[1]).head != 0 || len(tbl.v4) != 2 {
+		t.Errorf("Expected %s removed, got %v", prefixes[1], tbl.v4)
+	}
+}
+
+func TestTable_ReusesPaths(t *testing.T) {
+	tbl := newTable()
+	a := tbl.alloc(path{metric: 1})
+	b := tbl.alloc(path{metric: 2})
+	tbl.release(a)
+	if c := tbl.alloc(path{metric: 3}); c != a {
+		t.Errorf("Expected freed path %d reused, got %d", a, c)
+	}
+	if tbl.paths[b].metric != 2 || len(tbl.paths) != 3 {
+		t.Errorf("Unexpected arena %+v", tbl.paths)
+	}
+}
+
+func TestRIB_ReleasesStorage(t *testing.T) {
+	fibChan := make(chan api.FIBUpdate, 100)
+	r := NewSharded(fibChan, 1)
+	s := r.shards[0]
+
+	nh := netip.MustParseAddr("192.168.1.1")
+	for i := range 10 {
+		prefix := netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, byte(i), 0}), 24)
+		r.AddRoute(api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Prefix: prefix, NextHop: nh})
+		r.AddRoute(api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolBGP, Source: "peer", PathID: 1, Prefix: prefix, NextHop: nh})
+		r.DeleteRoute(api.RIBUpdate{Action: api.Delete, Protocol: api.ProtocolStatic, Prefix: prefix})
+		r.DeleteRoute(api.RIBUpdate{Action: api.Delete, Protocol: api.ProtocolBGP, Source: "peer", PathID: 1, Prefix: prefix})
+	}
+
+	if len(s.routes.paths) != 3 {
+		t.Errorf("Expected the arena to reuse 2 paths, got %d", len(s.routes.paths)-1)
+	}
+	if len(s.nextHops.ids) != 0 {
+		t.Errorf("Expected no next hops left, got %v", s.nextHops.ids)
+	}
+	if len(s.sources.ids) != 0 {
+		t.Errorf("Expected no sources left, got %v", s.sources.ids)
+	}
+}
+
+func TestInternProtocol_Full(t *testing.T) {
+	// Replace the shared table with one where every ID is taken.
+	prev := protocols.table.Load()
+	t.Cleanup(func() { protocols.table.Store(prev) })
+	full := &protocolTable{ids: make(map[string]protocolID)}
+	for i := range int(^protocolID(0)) + 1 {
+		name := fmt.Sprintf("test-%d", i)
+		full.ids[name] = protocolID(i)
+		full.names = append(full.names, protocol{name: name})
+	}
+	protocols.table.Store(full)
+
+	if id, ok := internProtocol("test-1"); !ok || id != 1 {
+		t.Errorf("Expected a registered name to keep ID 1, got %d, %v", id, ok)
+	}
+	if _, ok := internProtocol("test-new"); ok {
+		t.Error("Expected a new name to be rejected")
+	}
+
+	prefix := netip.MustParsePrefix("10.0.0.0/24")
+	r := NewSharded(make(chan api.FIBUpdate, 10), 1)
+	r.AddRoute(api.RIBUpdate{Action: api.Add, Protocol: "test-new", Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.1")})
+	if _, ok := r.Lookup(prefix); ok {
+		t.Errorf("Expected the route of a rejected protocol not to be stored")
+	}
+}
+
+func TestInternInstaller_Full(t *testing.T) {
+	// Replace the shared names with ones where every ID is taken.
+	prev := installers.names.Load()
+	t.Cleanup(func() { installers.names.Store(prev) })
+	full := []string{""}
+	for i := 1; i <= int(^installerID(0)); i++ {
+		full = append(full, fmt.Sprintf("test-%d", i))
+	}
+	installers.names.Store(&full)
+
+	if id, ok := internInstaller("test-1"); !ok || id != 1 {
+		t.Errorf("Expected a registered name to keep ID 1, got %d, %v", id, ok)
+	}
+	if id, ok := internInstaller(""); !ok || id != 0 {
+		t.Errorf("Expected no installer to have ID 0, got %d, %v", id, ok)
+	}
+	if _, ok := internInstaller("test-new"); ok {
+		t.Error("Expected a new name to be rejected")
+	}
+
+	prefix := netip.MustParsePrefix("10.0.0.0/24")
+	r := NewSharded(make(chan api.FIBUpdate, 10), 1)
+	r.AddRoute(api.RIBUpdate{Action: api.Add, Protocol: api.ProtocolStatic, Installer: "test-new", Prefix: prefix, NextHop: netip.MustParseAddr("192.168.1.1")})
+	if _, ok := r.Lookup(prefix); ok {
+		t.Errorf("Expected the route of a rejected installer not to be stored")
+	}
+}
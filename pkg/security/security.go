@@ -0,0 +1,235 @@
+// Package security provides transport credentials and per-RPC
+// authentication for the simulator's gRPC server.
+package security
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var logger = logging.For("security")
+
+// Metadata keys carrying per-RPC credentials, as sent by gnmic and other
+// gNMI clients.
+const (
+	UsernameKey = "username"
+	PasswordKey = "password"
+)
+
+// ServerOptions returns the gRPC server options implementing the configured
+// transport security and authentication.
+func ServerOptions(tlsCfg config.TLSConfig, authCfg config.AuthConfig) ([]grpc.ServerOption, error) {
+	var opts []grpc.ServerOption
+
+	tlsConfig, err := ServerTLSConfig(tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	if len(authCfg.Users) > 0 {
+		if tlsConfig == nil {
+			logger.Warn("Password authentication is enabled without TLS; credentials are sent in clear text")
+		}
+		a := NewAuthenticator(authCfg)
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(a.UnaryInterceptor),
+			grpc.ChainStreamInterceptor(a.StreamInterceptor),
+		)
+	}
+	return opts, nil
+}
+
+// ServerTLSConfig builds the server TLS configuration. It returns nil if TLS
+// is not enabled.
+func ServerTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	var cert tls.Certificate
+	switch {
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		var err error
+		if cert, err = tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load server certificate: %w", err)
+		}
+	case cfg.SelfSigned:
+		var err error
+		if cert, err = SelfSignedCert(); err != nil {
+			return nil, fmt.Errorf("failed to generate self-signed certificate: %w", err)
+		}
+	default:
+		if cfg.ClientAuth || cfg.CAFile != "" {
+			return nil, errors.New("client certificate verification requires a server certificate")
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if cfg.ClientAuth {
+		if tlsConfig.ClientCAs == nil {
+			return nil, errors.New("client_auth requires ca_file")
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// ClientCredentials returns the transport credentials for connecting to a
+// gRPC server. Without useTLS the connection is insecure.
+func ClientCredentials(useTLS bool, caFile string, skipVerify bool) (credentials.TransportCredentials, error) {
+	if !useTLS {
+		return insecure.NewCredentials(), nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// SelfSignedCert generates an ephemeral self-signed certificate valid for
+// localhost.
+func SelfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "aft-simulator"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// Authenticator checks username/password metadata against the configured
+// users and their RPC allow-lists.
+type Authenticator struct {
+	users map[string]config.UserConfig
+}
+
+// NewAuthenticator creates an Authenticator for cfg.
+func NewAuthenticator(cfg config.AuthConfig) *Authenticator {
+	users := make(map[string]config.UserConfig, len(cfg.Users))
+	for _, u := range cfg.Users {
+		users[u.Username] = u
+	}
+	return &Authenticator{users: users}
+}
+
+// UnaryInterceptor authorizes unary RPCs.
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := a.Authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor authorizes streaming RPCs.
+func (a *Authenticator) StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.Authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// Authorize verifies the credentials in ctx and that the user may call
+// fullMethod. The permission name is the lower-cased method name, e.g.
+// "/gnmi.gNMI/Subscribe" requires "subscribe".
+func (a *Authenticator) Authorize(ctx context.Context, fullMethod string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	username, password := first(md, UsernameKey), first(md, PasswordKey)
+
+	user, ok := a.users[username]
+	// Compare the password even for unknown users to avoid leaking which
+	// usernames exist through timing.
+	match := subtle.ConstantTimeCompare([]byte(password), []byte(user.Password)) == 1
+	if !ok || !match {
+		return status.Error(codes.Unauthenticated, "invalid username or password")
+	}
+
+	permission := strings.ToLower(path.Base(fullMethod))
+	for _, allowed := range user.Allow {
+		if allowed == "*" || strings.ToLower(allowed) == permission {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "user %q may not call %s", username, permission)
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package security
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// serve starts a gNMI server with opts that implements no RPCs. Calls that
+// pass the security checks therefore fail with Unimplemented.
+func serve(t *testing.T, opts []grpc.ServerOption, tlsConfig *tls.Config) gnmipb.GNMIClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(opts...)
+	gnmipb.RegisterGNMIServer(s, &gnmipb.UnimplementedGNMIServer{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///localhost",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return gnmipb.NewGNMIClient(conn)
+}
+
+func withCreds(username, password string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), UsernameKey, username, PasswordKey, password)
+}
+
+func TestServerOptions_SelfSignedWithAuth(t *testing.T) {
+	opts, err := ServerOptions(
+		config.TLSConfig{SelfSigned: true},
+		config.AuthConfig{Users: []config.UserConfig{
+			{Username: "collector", Password: "secret", Allow: []string{"subscribe"}},
+			{Username: "harness", Password: "secret", Allow: []string{"*"}},
+		}},
+	)
+	if err != nil {
+		t.Fatalf("ServerOptions failed: %v", err)
+	}
+	client := serve(t, opts, &tls.Config{InsecureSkipVerify: true})
+
+	tests := []struct {
+		desc     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{"no credentials", context.Background(), codes.Unauthenticated},
+		{"wrong password", withCreds("harness", "guess"), codes.Unauthenticated},
+		{"not allowed", withCreds("collector", "secret"), codes.PermissionDenied},
+		{"allowed", withCreds("harness", "secret"), codes.Unimplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := client.Set(tt.ctx, &gnmipb.SetRequest{})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("Set() code = %v, want %v (%v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestServerOptions_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := newCert(t, nil, nil, true)
+	serverCert, serverKey := newCert(t, caCert, caKey, false)
+	clientCert, clientKey := newCert(t, caCert, caKey, false)
+
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", caCert.Raw)
+	certFile := writePEM(t, dir, "server.pem", "CERTIFICATE", serverCert.Raw)
+	keyDER, err := x509.MarshalECPrivateKey(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writePEM(t, dir, "server-key.pem", "EC PRIVATE KEY", keyDER)
+
+	opts, err := ServerOptions(config.TLSConfig{
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		CAFile:     caFile,
+		ClientAuth: true,
+	}, config.AuthConfig{})
+	if err != nil {
+		t.Fatalf("ServerOptions failed: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	// A client without a certificate is rejected during the handshake.
+	client := serve(t, opts, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Set(ctx, &gnmipb.SetRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable without client certificate, got %v", err)
+	}
+
+	client = serve(t, opts, &tls.Config{
+		RootCAs:    roots,
+		ServerName: "localhost",
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{clientCert.Raw},
+			PrivateKey:  clientKey,
+		}},
+	})
+	if _, err := client.Set(ctx, &gnmipb.SetRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected Unimplemented with client certificate, got %v", err)
+	}
+}
+
+// newCert creates a certificate for localhost signed by parent, or a
+// self-signed one if parent is nil.
+func newCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
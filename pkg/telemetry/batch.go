@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// aftKey identifies an AFT entry independent of the action applied to it.
+type aftKey struct {
+	entryType api.AFTEntryType
+	prefix    netip.Prefix
+	label     uint32
+	nhg       uint64
+	nh        netip.Addr
+	nhType    api.NextHopType
+	iface     string
+	labels    string
+}
+
+func keyOf(update api.AFTUpdate) aftKey {
+	switch update.EntryType {
+	case api.AFTEntryPrefix:
+		return aftKey{entryType: update.EntryType, prefix: update.Prefix}
+	case api.AFTEntryLabel:
+		return aftKey{entryType: update.EntryType, label: update.Label}
+	case api.AFTEntryNextHopGroup:
+		return aftKey{entryType: update.EntryType, nhg: update.NextHopGroup}
+	}
+	return aftKey{entryType: update.EntryType, nh: update.NextHop, nhType: update.NextHopType, iface: update.Interface,
+		labels: update.PushedLabels.String()}
+}
+
+// batch coalesces AFT updates into a single notification. Only the latest
+// update for each entry is kept, so an add followed by a delete of the same
+// entry collapses into the delete.
+type batch struct {
+	updates []api.AFTUpdate
+	live    []bool
+	index   map[aftKey]int
+}
+
+func newBatch() *batch {
+	return &batch{index: make(map[aftKey]int)}
+}
+
+// Len returns the number of distinct entries in the batch.
+func (b *batch) Len() int {
+	return len(b.index)
+}
+
+// Add records update, superseding any earlier update for the same entry.
+// The entry moves to the end so that updates keep their causal order.
+func (b *batch) Add(update api.AFTUpdate) {
+	key := keyOf(update)
+	if i, ok := b.index[key]; ok {
+		b.live[i] = false
+	}
+	b.index[key] = len(b.updates)
+	b.updates = append(b.updates, update)
+	b.live = append(b.live, true)
+}
+
+// Reset discards all updates in the batch.
+func (b *batch) Reset() {
+	b.updates = b.updates[:0]
+	b.live = b.live[:0]
+	clear(b.index)
+}
+
+// EventTimes returns the event times of the updates in the batch.
+func (b *batch) EventTimes() []time.Time {
+	ts := make([]time.Time, 0, len(b.updates))
+	for i, update := range b.updates {
+		if b.live[i] {
+			ts = append(ts, update.EventTime)
+		}
+	}
+	return ts
+}
+
+// Flush encodes the batch into notifications and resets it. Consecutive
+// updates with the same timestamp share a notification stamped with it, so
+// that every entry is reported with its own last change time. Updates that
+// cannot be encoded are skipped. It returns nil if there is nothing to send.
+func (b *batch) Flush(enc gnmipb.Encoding) []*gnmipb.Notification {
+	var notifs []*gnmipb.Notification
+	var notif *gnmipb.Notification
+	var ts time.Time
+	for i, update := range b.updates {
+		if !b.live[i] {
+			continue
+		}
+		if notif == nil || !update.Timestamp.Equal(ts) {
+			ts = update.Timestamp
+			notif = newAFTNotification(ts)
+			notifs = append(notifs, notif)
+		}
+		// appendAFT leaves notif untouched on error.
+		_ = appendAFT(notif, update, enc)
+	}
+	b.Reset()
+
+	return slices.DeleteFunc(notifs, func(n *gnmipb.Notification) bool {
+		return len(n.Update) == 0 && len(n.Delete) == 0
+	})
+}
@@ -0,0 +1,77 @@
+package telemetry
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func TestBatch_Coalesce(t *testing.T) {
+	nh := netip.MustParseAddr("192.168.1.1")
+	p1 := netip.MustParsePrefix("10.0.0.0/24")
+	p2 := netip.MustParsePrefix("10.0.1.0/24")
+
+	b := newBatch()
+	b.Add(api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryNextHop, NextHop: nh})
+	b.Add(api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryPrefix, Prefix: p1, NextHopGroup: 1})
+	b.Add(api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryPrefix, Prefix: p2, NextHopGroup: 1})
+	// Add-then-delete collapses into the delete.
+	b.Add(api.AFTUpdate{Action: api.Delete, EntryType: api.AFTEntryPrefix, Prefix: p1})
+	// A later add of the same entry supersedes the earlier one.
+	b.Add(api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryPrefix, Prefix: p2, NextHopGroup: 2})
+
+	if b.Len() != 3 {
+		t.Fatalf("Expected 3 entries, got %d", b.Len())
+	}
+
+	notifs := b.Flush(gnmipb.Encoding_PROTO)
+	if len(notifs) != 1 {
+		t.Fatalf("Expected a single notification, got %d", len(notifs))
+	}
+	notif := notifs[0]
+	if p := PathString(notif.GetPrefix()); p != "/network-instances/network-instance[name=DEFAULT]/afts" {
+		t.Errorf("Unexpected prefix %s", p)
+	}
+	if len(notif.GetDelete()) != 1 || PathString(notif.GetDelete()[0]) != "/ipv4-unicast/ipv4-entry[prefix=10.0.0.0/24]" {
+		t.Errorf("Unexpected deletes %v", notif.GetDelete())
+	}
+
+	var nhg uint64
+	for _, u := range notif.GetUpdate() {
+		if PathString(u.GetPath()) == "/ipv4-unicast/ipv4-entry[prefix=10.0.1.0/24]/state/next-hop-group" {
+			nhg = u.GetVal().GetUintVal()
+		}
+	}
+	if nhg != 2 {
+		t.Errorf("Expected latest next-hop-group 2, got %d", nhg)
+	}
+
+	if b.Len() != 0 || b.Flush(gnmipb.Encoding_PROTO) != nil {
+		t.Error("Expected batch to be empty after flush")
+	}
+}
+
+func TestBatch_FlushTimestamp(t *testing.T) {
+	nh := netip.MustParseAddr("192.168.1.1")
+	b := newBatch()
+	b.Add(api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryNextHop, NextHop: nh, Timestamp: time.Unix(2000, 0)})
+	b.Add(api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryNextHopGroup, NextHopGroup: 1, NextHop: nh, Timestamp: time.Unix(1000, 0)})
+	b.Add(api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryPrefix, Prefix: netip.MustParsePrefix("10.0.0.0/24"), NextHopGroup: 1, Timestamp: time.Unix(1000, 0)})
+
+	// Each entry keeps its own timestamp; consecutive entries with the
+	// same one share a notification.
+	notifs := b.Flush(gnmipb.Encoding_PROTO)
+	if len(notifs) != 2 {
+		t.Fatalf("Expected 2 notifications, got %d", len(notifs))
+	}
+	if got := notifs[0].GetTimestamp(); got != time.Unix(2000, 0).UnixNano() {
+		t.Errorf("Expected the next-hop timestamp, got %d", got)
+	}
+	if got := notifs[1].GetTimestamp(); got != time.Unix(1000, 0).UnixNano() || len(ipv4Entries(notifs[1])) != 1 {
+		t.Errorf("Expected the group and prefix at their timestamp, got %v", notifs[1])
+	}
+}
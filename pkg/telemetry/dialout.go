@@ -0,0 +1,156 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/dialout"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+	"github.com/openconfig/aft-simulator/pkg/security"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// Reconnect backoff bounds for dial-out destinations.
+const (
+	minDialOutBackoff = 500 * time.Millisecond
+	maxDialOutBackoff = 30 * time.Second
+)
+
+var dialOutLogger = logging.For("dialout")
+
+var dialOutConnects = metrics.Default.CounterVec("aftsim_dialout_connects_total",
+	"Dial-out publish streams opened, by destination.", "destination")
+
+// dialOutDest is a validated dial-out destination.
+type dialOutDest struct {
+	address string
+	conn    *grpc.ClientConn
+	opts    streamOptions
+}
+
+// RunDialOut streams the AFT to every destination in dests until ctx is
+// canceled. Each destination receives the same sequence as a Subscribe
+// client: a snapshot, a sync_response and incremental updates. Failed
+// connections are retried with exponential backoff, starting each new
+// connection with a fresh snapshot.
+func (s *GNMIServer) RunDialOut(ctx context.Context, dests []config.DialOutConfig) error {
+	var valid []*dialOutDest
+	for _, d := range dests {
+		dest, err := newDialOutDest(d, s.policy)
+		if err != nil {
+			return fmt.Errorf("dial-out %s: %w", d.Address, err)
+		}
+		defer dest.conn.Close()
+		valid = append(valid, dest)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, dest := range valid {
+		g.Go(func() error {
+			s.export(ctx, dest)
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+func newDialOutDest(cfg config.DialOutConfig, policy SlowSubscriberPolicy) (*dialOutDest, error) {
+	encoding := gnmipb.Encoding_PROTO
+	if cfg.Encoding != "" {
+		v, ok := gnmipb.Encoding_value[strings.ToUpper(cfg.Encoding)]
+		if !ok {
+			return nil, fmt.Errorf("unknown encoding %q", cfg.Encoding)
+		}
+		encoding = gnmipb.Encoding(v)
+	}
+	if err := checkEncoding(encoding); err != nil {
+		return nil, err
+	}
+	match, err := pathMatcher(cfg.Paths)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := security.ClientCredentials(cfg.TLS, cfg.CAFile, cfg.SkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(cfg.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &dialOutDest{
+		address: cfg.Address,
+		conn:    conn,
+		opts:    streamOptions{encoding: encoding, policy: policy, match: match, remote: "dial-out " + cfg.Address},
+	}, nil
+}
+
+// export publishes to dest, reconnecting until ctx is canceled.
+func (s *GNMIServer) export(ctx context.Context, dest *dialOutDest) {
+	backoff := minDialOutBackoff
+	for {
+		start := time.Now()
+		err := s.publish(ctx, dest)
+		if ctx.Err() != nil {
+			return
+		}
+		// A stream that stayed up longer than the maximum backoff was
+		// healthy; start over from the minimum.
+		if time.Since(start) > maxDialOutBackoff {
+			backoff = minDialOutBackoff
+		}
+		dialOutLogger.Warn("Stream failed, retrying", "destination", dest.address, "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxDialOutBackoff)
+	}
+}
+
+// publish runs a single Publish stream to dest.
+func (s *GNMIServer) publish(ctx context.Context, dest *dialOutDest) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := dialout.NewPublishClient(ctx, dest.conn)
+	if err != nil {
+		return err
+	}
+	dialOutConnects.With(dest.address).Inc()
+	dialOutLogger.Info("Connected", "destination", dest.address)
+
+	// The collector ends the stream by returning from Publish. Watch for
+	// that concurrently so that a quiet stream does not go unnoticed.
+	closed := make(chan error, 1)
+	go func() {
+		closed <- stream.RecvMsg(new(emptypb.Empty))
+		cancel()
+	}()
+
+	if err := s.serve(ctx, stream, dest.opts); err != nil {
+		return err
+	}
+	// serve returns nil once ctx is canceled, either by the caller or
+	// because the collector ended the stream.
+	select {
+	case err := <-closed:
+		if err == nil {
+			err = errors.New("stream closed by collector")
+		}
+		return err
+	default:
+		return ctx.Err()
+	}
+}
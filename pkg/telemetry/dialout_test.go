@@ -0,0 +1,104 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/dialout"
+	"github.com/openconfig/aft-simulator/pkg/fib"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// testCollector records the responses of every Publish stream it receives.
+// Each stream is closed after maxResponses responses.
+type testCollector struct {
+	maxResponses int
+	streams      chan []*gnmipb.SubscribeResponse
+}
+
+func (c *testCollector) Publish(stream dialout.PublishServer) error {
+	var resps []*gnmipb.SubscribeResponse
+	defer func() {
+		select {
+		case c.streams <- resps:
+		default:
+		}
+	}()
+	for len(resps) < c.maxResponses {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		resps = append(resps, resp)
+	}
+	return stream.SendAndClose(&emptypb.Empty{})
+}
+
+func TestRunDialOut(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	// Expect the snapshot of one prefix entry, the sync_response and one update.
+	collector := &testCollector{maxResponses: 3, streams: make(chan []*gnmipb.SubscribeResponse, 2)}
+	gs := grpc.NewServer()
+	dialout.RegisterCollectorServer(gs, collector)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	telemetryChan := make(chan api.AFTUpdate, 100)
+	f := fib.New(telemetryChan)
+	s := New(f, telemetryChan, nil, config.TelemetryConfig{BatchSize: 1})
+	nh := netip.MustParseAddr("192.168.1.1")
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/24"), NextHop: nh})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go s.Run(ctx)
+	go s.RunDialOut(ctx, []config.DialOutConfig{{
+		Address: lis.Addr().String(),
+		Paths:   []string{"/network-instances/network-instance/afts/ipv4-unicast"},
+	}})
+
+	// Wait for the first stream to be set up before changing the FIB.
+	time.Sleep(100 * time.Millisecond)
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.1.0/24"), NextHop: nh})
+
+	var resps []*gnmipb.SubscribeResponse
+	select {
+	case resps = <-collector.streams:
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for dial-out stream")
+	}
+	if len(resps) != 3 {
+		t.Fatalf("Expected 3 responses, got %d: %v", len(resps), resps)
+	}
+	if got := ipv4Entries(resps[0].GetUpdate()); len(got) != 1 || got[0] != "10.0.0.0/24" {
+		t.Errorf("Expected snapshot of 10.0.0.0/24 only, got %v", resps[0])
+	}
+	if !resps[1].GetSyncResponse() {
+		t.Errorf("Expected sync_response, got %v", resps[1])
+	}
+	if got := ipv4Entries(resps[2].GetUpdate()); len(got) != 1 || got[0] != "10.0.1.0/24" {
+		t.Errorf("Expected update of 10.0.1.0/24, got %v", resps[2])
+	}
+
+	// The collector closed the stream, so the exporter reconnects and
+	// starts over with a snapshot of both prefixes.
+	select {
+	case resps = <-collector.streams:
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for dial-out reconnect")
+	}
+	if len(resps) == 0 || len(ipv4Entries(resps[0].GetUpdate())) != 1 {
+		t.Errorf("Expected a new snapshot after reconnecting, got %v", resps)
+	}
+}
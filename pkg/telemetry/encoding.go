@@ -0,0 +1,292 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// aftLeaf is a single leaf of an AFT entry, addressed relative to the entry's list element.
+type aftLeaf struct {
+	path []*gnmipb.PathElem
+	val  *gnmipb.TypedValue
+	// uint32 marks integers of 32 bits, which JSON_IETF encodes as numbers
+	// rather than strings.
+	uint32 bool
+}
+
+// checkEncoding reports whether enc is supported for AFT notifications.
+func checkEncoding(enc gnmipb.Encoding) error {
+	switch enc {
+	case gnmipb.Encoding_PROTO, gnmipb.Encoding_JSON, gnmipb.Encoding_JSON_IETF:
+		return nil
+	}
+	return fmt.Errorf("encoding %v is not supported", enc)
+}
+
+// aftsPath returns the path of the AFT container of the default network instance.
+func aftsPath() []*gnmipb.PathElem {
+	return []*gnmipb.PathElem{
+		{Name: "network-instances"},
+		{Name: "network-instance", Key: map[string]string{"name": api.NetworkInstanceDefault}},
+		{Name: "afts"},
+	}
+}
+
+// aftEntry returns the path of the list element for update, relative to the
+// AFT container, and the full set of state leaves of that entry.
+func aftEntry(update api.AFTUpdate) ([]*gnmipb.PathElem, []aftLeaf, error) {
+	switch update.EntryType {
+	case api.AFTEntryPrefix:
+		prefix := update.Prefix.String()
+		entry := []*gnmipb.PathElem{
+			{Name: "ipv4-unicast"},
+			{Name: "ipv4-entry", Key: map[string]string{"prefix": prefix}},
+		}
+		if update.Prefix.Addr().Is6() {
+			entry[0].Name, entry[1].Name = "ipv6-unicast", "ipv6-entry"
+		}
+		return entry, []aftLeaf{
+			{path: leafPath("prefix"), val: stringVal(prefix)},
+			{path: leafPath("state", "prefix"), val: stringVal(prefix)},
+			{path: leafPath("state", "next-hop-group"), val: uintVal(update.NextHopGroup)},
+		}, nil
+
+	case api.AFTEntryNextHopGroup:
+		entry := []*gnmipb.PathElem{
+			{Name: "next-hop-groups"},
+			{Name: "next-hop-group", Key: map[string]string{"id": strconv.FormatUint(update.NextHopGroup, 10)}},
+		}
+		// Next hops within a group are keyed by the index used for the
+		// next-hop entry itself.
+		index := api.NextHopString(update.NextHopType, update.NextHop, update.Interface, update.PushedLabels)
+		member := func(elems ...string) []*gnmipb.PathElem {
+			p := []*gnmipb.PathElem{
+				{Name: "next-hops"},
+				{Name: "next-hop", Key: map[string]string{"index": index}},
+			}
+			return append(p, leafPath(elems...)...)
+		}
+		leaves := []aftLeaf{
+			{path: leafPath("id"), val: uintVal(update.NextHopGroup)},
+			{path: leafPath("state", "id"), val: uintVal(update.NextHopGroup)},
+			{path: member("state", "index"), val: stringVal(index)},
+			{path: member("state", "weight"), val: uintVal(1)},
+		}
+		// Groups that do not forward the traffic carry their action.
+		switch update.NextHopType {
+		case api.NextHopDrop, api.NextHopReceive:
+			leaves = append(leaves, aftLeaf{path: leafPath("state", "action"), val: stringVal(string(update.NextHopType))})
+		}
+		return entry, leaves, nil
+
+	case api.AFTEntryNextHop:
+		// Next hops without an address are indexed by their interface or,
+		// such as DROP, their type. Next hops pushing labels are distinct
+		// from those that do not.
+		index := api.NextHopString(update.NextHopType, update.NextHop, update.Interface, update.PushedLabels)
+		entry := []*gnmipb.PathElem{
+			{Name: "next-hops"},
+			{Name: "next-hop", Key: map[string]string{"index": index}},
+		}
+		leaves := []aftLeaf{
+			{path: leafPath("index"), val: stringVal(index)},
+			{path: leafPath("state", "index"), val: stringVal(index)},
+		}
+		switch update.NextHopType {
+		case api.NextHopIP:
+			leaves = append(leaves, aftLeaf{path: leafPath("state", "ip-address"), val: stringVal(update.NextHop.String())})
+		case api.NextHopInterface:
+			leaves = append(leaves, aftLeaf{path: leafPath("interface-ref", "state", "interface"), val: stringVal(update.Interface)})
+		}
+		if len(update.PushedLabels) > 0 {
+			leaves = append(leaves, aftLeaf{path: leafPath("state", "pushed-mpls-label-stack"),
+				val: labelsVal(update.PushedLabels), uint32: true})
+		}
+		return entry, leaves, nil
+
+	case api.AFTEntryLabel:
+		label := strconv.FormatUint(uint64(update.Label), 10)
+		entry := []*gnmipb.PathElem{
+			{Name: "mpls"},
+			{Name: "label-entry", Key: map[string]string{"label": label}},
+		}
+		// Every label entry pops its label; the next hop may push others
+		// in its place.
+		return entry, []aftLeaf{
+			{path: leafPath("label"), val: uintVal(uint64(update.Label)), uint32: true},
+			{path: leafPath("state", "label"), val: uintVal(uint64(update.Label)), uint32: true},
+			{path: leafPath("state", "next-hop-group"), val: uintVal(update.NextHopGroup)},
+			{path: leafPath("state", "popped-mpls-label-stack"), val: labelsVal(api.LabelStack{update.Label}), uint32: true},
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown AFT entry type: %v", update.EntryType)
+}
+
+// newAFTNotification returns an empty notification whose prefix is the AFT
+// container. Paths added by appendAFT are relative to that prefix. The
+// notification is stamped with ts, or the current time if ts is zero.
+func newAFTNotification(ts time.Time) *gnmipb.Notification {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return &gnmipb.Notification{
+		Timestamp: ts.UnixNano(),
+		Prefix:    &gnmipb.Path{Elem: aftsPath()},
+	}
+}
+
+// aftToNotification converts update into a notification carrying the complete
+// state container of the affected entry.
+func aftToNotification(update api.AFTUpdate, enc gnmipb.Encoding) (*gnmipb.Notification, error) {
+	notif := newAFTNotification(update.Timestamp)
+	if err := appendAFT(notif, update, enc); err != nil {
+		return nil, err
+	}
+	return notif, nil
+}
+
+// appendAFT adds update to notif. Deletes remove the list element itself.
+// Otherwise, with PROTO encoding each leaf of the entry is a separate update;
+// with JSON and JSON_IETF the entry is a single JSON blob.
+func appendAFT(notif *gnmipb.Notification, update api.AFTUpdate, enc gnmipb.Encoding) error {
+	path, leaves, err := aftEntry(update)
+	if err != nil {
+		return err
+	}
+
+	if update.Action == api.Delete {
+		notif.Delete = append(notif.Delete, &gnmipb.Path{Elem: path})
+		return nil
+	}
+
+	switch enc {
+	case gnmipb.Encoding_PROTO:
+		for _, l := range leaves {
+			notif.Update = append(notif.Update, &gnmipb.Update{
+				Path: &gnmipb.Path{Elem: append(append([]*gnmipb.PathElem{}, path...), l.path...)},
+				Val:  l.val,
+			})
+		}
+
+	case gnmipb.Encoding_JSON, gnmipb.Encoding_JSON_IETF:
+		ietf := enc == gnmipb.Encoding_JSON_IETF
+		blob, err := json.Marshal(leavesToJSON(leaves, ietf))
+		if err != nil {
+			return err
+		}
+		val := &gnmipb.TypedValue{Value: &gnmipb.TypedValue_JsonVal{JsonVal: blob}}
+		if ietf {
+			val = &gnmipb.TypedValue{Value: &gnmipb.TypedValue_JsonIetfVal{JsonIetfVal: blob}}
+		}
+		notif.Update = append(notif.Update, &gnmipb.Update{Path: &gnmipb.Path{Elem: path}, Val: val})
+
+	default:
+		return checkEncoding(enc)
+	}
+	return nil
+}
+
+// leavesToJSON nests leaves into a JSON object tree. Keyed path elements
+// become members of JSON arrays, as described in RFC 7951.
+func leavesToJSON(leaves []aftLeaf, ietf bool) map[string]any {
+	root := map[string]any{}
+	for _, l := range leaves {
+		obj := root
+		for i, e := range l.path {
+			if i == len(l.path)-1 {
+				obj[e.GetName()] = jsonValue(l.val, ietf && !l.uint32)
+				break
+			}
+			if len(e.GetKey()) == 0 {
+				child, ok := obj[e.GetName()].(map[string]any)
+				if !ok {
+					child = map[string]any{}
+					obj[e.GetName()] = child
+				}
+				obj = child
+				continue
+			}
+			list, _ := obj[e.GetName()].([]any)
+			var member map[string]any
+			for _, m := range list {
+				if mm := m.(map[string]any); hasKeys(mm, e.GetKey()) {
+					member = mm
+					break
+				}
+			}
+			if member == nil {
+				member = map[string]any{}
+				for k, v := range e.GetKey() {
+					member[k] = v
+				}
+				obj[e.GetName()] = append(list, member)
+			}
+			obj = member
+		}
+	}
+	return root
+}
+
+func hasKeys(member map[string]any, keys map[string]string) bool {
+	for k, v := range keys {
+		if member[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonValue converts a scalar or leaf-list TypedValue to its JSON
+// representation. RFC 7951 requires 64-bit integers to be encoded as strings
+// in JSON_IETF; ietf is false for leaves of narrower integers.
+func jsonValue(val *gnmipb.TypedValue, ietf bool) any {
+	switch v := val.GetValue().(type) {
+	case *gnmipb.TypedValue_LeaflistVal:
+		elems := make([]any, 0, len(v.LeaflistVal.GetElement()))
+		for _, e := range v.LeaflistVal.GetElement() {
+			elems = append(elems, jsonValue(e, ietf))
+		}
+		return elems
+	case *gnmipb.TypedValue_UintVal:
+		if ietf {
+			return strconv.FormatUint(v.UintVal, 10)
+		}
+		return v.UintVal
+	case *gnmipb.TypedValue_StringVal:
+		return v.StringVal
+	case *gnmipb.TypedValue_BoolVal:
+		return v.BoolVal
+	}
+	return nil
+}
+
+func leafPath(elems ...string) []*gnmipb.PathElem {
+	p := make([]*gnmipb.PathElem, 0, len(elems))
+	for _, e := range elems {
+		p = append(p, &gnmipb.PathElem{Name: e})
+	}
+	return p
+}
+
+func stringVal(s string) *gnmipb.TypedValue {
+	return &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: s}}
+}
+
+func uintVal(u uint64) *gnmipb.TypedValue {
+	return &gnmipb.TypedValue{Value: &gnmipb.TypedValue_UintVal{UintVal: u}}
+}
+
+// labelsVal returns a leaf-list of the labels of l.
+func labelsVal(l api.LabelStack) *gnmipb.TypedValue {
+	elems := make([]*gnmipb.TypedValue, len(l))
+	for i, label := range l {
+		elems[i] = uintVal(uint64(label))
+	}
+	return &gnmipb.TypedValue{Value: &gnmipb.TypedValue_LeaflistVal{LeaflistVal: &gnmipb.ScalarArray{Element: elems}}}
+}
@@ -0,0 +1,252 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func TestAFTToNotification_Proto(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:       api.Add,
+		EntryType:    api.AFTEntryNextHopGroup,
+		NextHopGroup: 42,
+		NextHop:      netip.MustParseAddr("192.168.1.1"),
+	}, gnmipb.Encoding_PROTO)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+
+	got := map[string]*gnmipb.TypedValue{}
+	for _, u := range notif.GetUpdate() {
+		got[PathString(notif.GetPrefix())+PathString(u.GetPath())] = u.GetVal()
+	}
+	base := "/network-instances/network-instance[name=DEFAULT]/afts/next-hop-groups/next-hop-group[id=42]"
+	want := map[string]uint64{
+		base + "/id":       42,
+		base + "/state/id": 42,
+		base + "/next-hops/next-hop[index=192.168.1.1]/state/weight": 1,
+	}
+	for path, v := range want {
+		if got[path].GetUintVal() != v {
+			t.Errorf("Leaf %s = %v, want %d", path, got[path], v)
+		}
+	}
+	if idx := got[base+"/next-hops/next-hop[index=192.168.1.1]/state/index"]; idx.GetStringVal() != "192.168.1.1" {
+		t.Errorf("Unexpected next-hop index %v", idx)
+	}
+}
+
+func TestAFTToNotification_IPv6Prefix(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:       api.Add,
+		EntryType:    api.AFTEntryPrefix,
+		Prefix:       netip.MustParsePrefix("2001:db8::/32"),
+		NextHopGroup: 42,
+	}, gnmipb.Encoding_PROTO)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+
+	got := map[string]*gnmipb.TypedValue{}
+	for _, u := range notif.GetUpdate() {
+		got[PathString(notif.GetPrefix())+PathString(u.GetPath())] = u.GetVal()
+	}
+	base := "/network-instances/network-instance[name=DEFAULT]/afts/ipv6-unicast/ipv6-entry[prefix=2001:db8::/32]"
+	if len(got) != 3 || got[base+"/state/prefix"].GetStringVal() != "2001:db8::/32" ||
+		got[base+"/state/next-hop-group"].GetUintVal() != 42 {
+		t.Errorf("Unexpected updates %v", got)
+	}
+
+	// Subscriptions to ipv4-unicast do not match IPv6 prefixes.
+	match, err := pathMatcher([]string{"/network-instances/network-instance/afts/ipv4-unicast"})
+	if err != nil {
+		t.Fatalf("pathMatcher failed: %v", err)
+	}
+	if match(api.AFTUpdate{EntryType: api.AFTEntryPrefix, Prefix: netip.MustParsePrefix("2001:db8::/32")}) {
+		t.Error("Expected ipv4-unicast not to match an IPv6 prefix")
+	}
+}
+
+func TestAFTToNotification_JSONIETF(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:       api.Add,
+		EntryType:    api.AFTEntryPrefix,
+		Prefix:       netip.MustParsePrefix("10.0.0.0/24"),
+		NextHopGroup: 42,
+	}, gnmipb.Encoding_JSON_IETF)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+	if len(notif.GetUpdate()) != 1 {
+		t.Fatalf("Expected a single update, got %d", len(notif.GetUpdate()))
+	}
+	u := notif.GetUpdate()[0]
+	if p := PathString(notif.GetPrefix()) + PathString(u.GetPath()); p != "/network-instances/network-instance[name=DEFAULT]/afts/ipv4-unicast/ipv4-entry[prefix=10.0.0.0/24]" {
+		t.Errorf("Unexpected path %s", p)
+	}
+
+	var entry struct {
+		Prefix string `json:"prefix"`
+		State  struct {
+			Prefix       string `json:"prefix"`
+			NextHopGroup string `json:"next-hop-group"`
+		} `json:"state"`
+	}
+	if err := json.Unmarshal(u.GetVal().GetJsonIetfVal(), &entry); err != nil {
+		t.Fatalf("Invalid JSON_IETF value: %v", err)
+	}
+	if entry.Prefix != "10.0.0.0/24" || entry.State.Prefix != "10.0.0.0/24" || entry.State.NextHopGroup != "42" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
+
+func TestAFTToNotification_Delete(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:    api.Delete,
+		EntryType: api.AFTEntryNextHop,
+		NextHop:   netip.MustParseAddr("192.168.1.1"),
+	}, gnmipb.Encoding_JSON_IETF)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+	if len(notif.GetDelete()) != 1 || len(notif.GetUpdate()) != 0 {
+		t.Fatalf("Expected a single delete, got %v", notif)
+	}
+	if p := PathString(notif.GetPrefix()) + PathString(notif.GetDelete()[0]); p != "/network-instances/network-instance[name=DEFAULT]/afts/next-hops/next-hop[index=192.168.1.1]" {
+		t.Errorf("Unexpected delete path %s", p)
+	}
+}
+
+func TestAFTToNotification_DropNextHop(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:      api.Add,
+		EntryType:   api.AFTEntryNextHop,
+		NextHopType: api.NextHopDrop,
+	}, gnmipb.Encoding_PROTO)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+
+	got := map[string]*gnmipb.TypedValue{}
+	for _, u := range notif.GetUpdate() {
+		got[PathString(notif.GetPrefix())+PathString(u.GetPath())] = u.GetVal()
+	}
+	base := "/network-instances/network-instance[name=DEFAULT]/afts/next-hops/next-hop[index=DROP]"
+	if idx := got[base+"/state/index"]; idx.GetStringVal() != "DROP" {
+		t.Errorf("Unexpected next-hop index %v", idx)
+	}
+	if ip, ok := got[base+"/state/ip-address"]; ok {
+		t.Errorf("Unexpected ip-address leaf %v on a drop next hop", ip)
+	}
+}
+
+func TestAFTToNotification_InterfaceNextHop(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:      api.Add,
+		EntryType:   api.AFTEntryNextHop,
+		NextHopType: api.NextHopInterface,
+		Interface:   "eth0",
+	}, gnmipb.Encoding_PROTO)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+
+	got := map[string]*gnmipb.TypedValue{}
+	for _, u := range notif.GetUpdate() {
+		got[PathString(notif.GetPrefix())+PathString(u.GetPath())] = u.GetVal()
+	}
+	base := "/network-instances/network-instance[name=DEFAULT]/afts/next-hops/next-hop[index=eth0]"
+	if intf := got[base+"/interface-ref/state/interface"]; intf.GetStringVal() != "eth0" {
+		t.Errorf("Unexpected interface-ref %v", intf)
+	}
+	if ip, ok := got[base+"/state/ip-address"]; ok {
+		t.Errorf("Unexpected ip-address leaf %v on an interface next hop", ip)
+	}
+}
+
+func TestAFTToNotification_DropNextHopGroup(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:       api.Add,
+		EntryType:    api.AFTEntryNextHopGroup,
+		NextHopGroup: 42,
+		NextHopType:  api.NextHopDrop,
+	}, gnmipb.Encoding_PROTO)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+
+	got := map[string]*gnmipb.TypedValue{}
+	for _, u := range notif.GetUpdate() {
+		got[PathString(notif.GetPrefix())+PathString(u.GetPath())] = u.GetVal()
+	}
+	base := "/network-instances/network-instance[name=DEFAULT]/afts/next-hop-groups/next-hop-group[id=42]"
+	if action := got[base+"/state/action"]; action.GetStringVal() != "DROP" {
+		t.Errorf("Unexpected next-hop group action %v", action)
+	}
+	if idx := got[base+"/next-hops/next-hop[index=DROP]/state/index"]; idx.GetStringVal() != "DROP" {
+		t.Errorf("Unexpected next-hop index %v", idx)
+	}
+}
+
+func TestAFTToNotification_LabelEntry(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:       api.Add,
+		EntryType:    api.AFTEntryLabel,
+		Label:        16001,
+		NextHopGroup: 42,
+	}, gnmipb.Encoding_JSON_IETF)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+	u := notif.GetUpdate()[0]
+	if p := PathString(notif.GetPrefix()) + PathString(u.GetPath()); p != "/network-instances/network-instance[name=DEFAULT]/afts/mpls/label-entry[label=16001]" {
+		t.Errorf("Unexpected path %s", p)
+	}
+
+	// Labels are 32-bit integers, encoded as JSON numbers.
+	var entry struct {
+		Label uint32 `json:"label"`
+		State struct {
+			Label        uint32   `json:"label"`
+			NextHopGroup string   `json:"next-hop-group"`
+			Popped       []uint32 `json:"popped-mpls-label-stack"`
+		} `json:"state"`
+	}
+	if err := json.Unmarshal(u.GetVal().GetJsonIetfVal(), &entry); err != nil {
+		t.Fatalf("Invalid JSON_IETF value: %v", err)
+	}
+	if entry.Label != 16001 || entry.State.Label != 16001 || entry.State.NextHopGroup != "42" ||
+		len(entry.State.Popped) != 1 || entry.State.Popped[0] != 16001 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
+
+func TestAFTToNotification_PushedLabels(t *testing.T) {
+	notif, err := aftToNotification(api.AFTUpdate{
+		Action:       api.Add,
+		EntryType:    api.AFTEntryNextHop,
+		NextHop:      netip.MustParseAddr("192.168.1.1"),
+		PushedLabels: api.LabelStack{16001, 16002},
+	}, gnmipb.Encoding_PROTO)
+	if err != nil {
+		t.Fatalf("aftToNotification failed: %v", err)
+	}
+
+	got := map[string]*gnmipb.TypedValue{}
+	for _, u := range notif.GetUpdate() {
+		got[PathString(notif.GetPrefix())+PathString(u.GetPath())] = u.GetVal()
+	}
+	base := "/network-instances/network-instance[name=DEFAULT]/afts/next-hops/next-hop[index=192.168.1.1 push 16001/16002]"
+	stack := got[base+"/state/pushed-mpls-label-stack"].GetLeaflistVal().GetElement()
+	if len(stack) != 2 || stack[0].GetUintVal() != 16001 || stack[1].GetUintVal() != 16002 {
+		t.Errorf("Unexpected pushed-mpls-label-stack %v", stack)
+	}
+	if ip := got[base+"/state/ip-address"]; ip.GetStringVal() != "192.168.1.1" {
+		t.Errorf("Unexpected ip-address %v", ip)
+	}
+}
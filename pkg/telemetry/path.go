@@ -0,0 +1,132 @@
+package telemetry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// PathString renders p in the usual /a/b[k=v] form.
+func PathString(p *gnmipb.Path) string {
+	return elemsString(p.GetElem())
+}
+
+func elemsString(elems []*gnmipb.PathElem) string {
+	var b strings.Builder
+	for _, e := range elems {
+		b.WriteString("/")
+		b.WriteString(e.GetName())
+		keys := make([]string, 0, len(e.GetKey()))
+		for k := range e.GetKey() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "[%s=%s]", k, e.GetKey()[k])
+		}
+	}
+	return b.String()
+}
+
+// ParsePath parses a path in the /a/b[k=v] form. Key values may contain
+// '/' characters, as in prefixes.
+func ParsePath(s string) (*gnmipb.Path, error) {
+	p := &gnmipb.Path{}
+	s = strings.TrimPrefix(s, "/")
+	for s != "" {
+		var elem *gnmipb.PathElem
+		var err error
+		if elem, s, err = parseElem(s); err != nil {
+			return nil, err
+		}
+		p.Elem = append(p.Elem, elem)
+	}
+	return p, nil
+}
+
+// parseElem parses the first element of s and returns it with the remainder
+// of s after the element's trailing '/'.
+func parseElem(s string) (*gnmipb.PathElem, string, error) {
+	end := strings.IndexAny(s, "/[")
+	if end < 0 {
+		end = len(s)
+	}
+	elem := &gnmipb.PathElem{Name: s[:end]}
+	if elem.Name == "" {
+		return nil, "", fmt.Errorf("empty path element in %q", s)
+	}
+	s = s[end:]
+	for strings.HasPrefix(s, "[") {
+		rb := strings.Index(s, "]")
+		if rb < 0 {
+			return nil, "", fmt.Errorf("unterminated key in %q", s)
+		}
+		k, v, ok := strings.Cut(s[1:rb], "=")
+		if !ok || k == "" {
+			return nil, "", fmt.Errorf("invalid key %q", s[:rb+1])
+		}
+		if elem.Key == nil {
+			elem.Key = make(map[string]string)
+		}
+		elem.Key[k] = v
+		s = s[rb+1:]
+	}
+	if s != "" && s[0] != '/' {
+		return nil, "", fmt.Errorf("unexpected %q after path element %s", s, elem.Name)
+	}
+	return elem, strings.TrimPrefix(s, "/"), nil
+}
+
+// pathMatcher returns a filter selecting AFT updates whose entry path
+// overlaps one of paths. Paths are absolute, e.g.
+// /network-instances/network-instance[name=DEFAULT]/afts/ipv4-unicast.
+// Elements without keys match any key, and "*" matches any element.
+// An empty list matches every update.
+func pathMatcher(paths []string) (func(api.AFTUpdate) bool, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	var filters []*gnmipb.Path
+	for _, s := range paths {
+		p, err := ParsePath(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", s, err)
+		}
+		filters = append(filters, p)
+	}
+
+	return func(update api.AFTUpdate) bool {
+		entry, _, err := aftEntry(update)
+		if err != nil {
+			return false
+		}
+		full := append(aftsPath(), entry...)
+		for _, f := range filters {
+			if elemsOverlap(f.GetElem(), full) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// elemsOverlap reports whether one of a and b is a prefix of the other,
+// treating missing keys and "*" names in a as wildcards.
+func elemsOverlap(a, b []*gnmipb.PathElem) bool {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i].GetName() != "*" && a[i].GetName() != b[i].GetName() {
+			return false
+		}
+		for k, v := range a[i].GetKey() {
+			if v != "*" && b[i].GetKey()[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
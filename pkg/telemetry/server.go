@@ -2,37 +2,75 @@ package telemetry
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
 	"github.com/openconfig/aft-simulator/pkg/fib"
+	"github.com/openconfig/aft-simulator/pkg/latency"
+	"github.com/openconfig/aft-simulator/pkg/logging"
+	"github.com/openconfig/aft-simulator/pkg/metrics"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
 )
 
+var logger = logging.For("gnmi")
+
 // GNMIServer implements the gNMI service.
 type GNMIServer struct {
 	gnmipb.UnimplementedGNMIServer
 
 	fib           *fib.FIB
 	telemetryChan <-chan api.AFTUpdate
+	ribChan       chan<- api.RIBUpdate
+	cfg           config.TelemetryConfig
+
+	// policy, queueSize and blockTimeout configure the fan-out to slow subscribers.
+	policy       SlowSubscriberPolicy
+	queueSize    int
+	blockTimeout time.Duration
 
 	subMu        sync.RWMutex
-	subscribers  map[int64]chan api.AFTUpdate
+	subscribers  map[int64]*subscriber
 	subIDCounter int64
+
+	// setMu serializes Set requests against the simulator config subtree.
+	setMu sync.Mutex
+	sim   *simState
 }
 
 // New creates a new GNMIServer.
-func New(f *fib.FIB, telemetryChan <-chan api.AFTUpdate) *GNMIServer {
+// Updates applied through the gNMI Set RPC are injected into ribChan.
+func New(f *fib.FIB, telemetryChan <-chan api.AFTUpdate, ribChan chan<- api.RIBUpdate, cfg config.TelemetryConfig) *GNMIServer {
+	policy, err := ParseSlowSubscriberPolicy(cfg.SlowSubscriberPolicy)
+	if err != nil {
+		logger.Warn("Invalid slow subscriber policy, using default", "error", err, "policy", PolicyResync)
+		policy = PolicyResync
+	}
+	queueSize := cfg.SubscriberQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	blockTimeout := time.Duration(cfg.BlockTimeoutMs) * time.Millisecond
+	if blockTimeout <= 0 {
+		blockTimeout = defaultBlockTimeout
+	}
 	return &GNMIServer{
 		fib:           f,
 		telemetryChan: telemetryChan,
-		subscribers:   make(map[int64]chan api.AFTUpdate),
+		ribChan:       ribChan,
+		cfg:           cfg,
+		policy:        policy,
+		queueSize:     queueSize,
+		blockTimeout:  blockTimeout,
+		subscribers:   make(map[int64]*subscriber),
+		sim:           newSimState(),
 	}
 }
 
@@ -55,12 +93,8 @@ func (s *GNMIServer) Run(ctx context.Context) error {
 func (s *GNMIServer) sendToSubscribers(update api.AFTUpdate) {
 	s.subMu.RLock()
 	defer s.subMu.RUnlock()
-	for id, subChan := range s.subscribers {
-		select {
-		case subChan <- update:
-		default:
-			go log.Printf("GNMIServer: subscriber channel full unable to send to subscriber %d", id)
-		}
+	for _, sub := range s.subscribers {
+		sub.enqueue(update, s.blockTimeout)
 	}
 }
 
@@ -74,158 +108,185 @@ func (s *GNMIServer) Subscribe(stream gnmipb.GNMI_SubscribeServer) error {
 	if req.GetSubscribe().GetMode() != gnmipb.SubscriptionList_STREAM {
 		return status.Errorf(codes.Unimplemented, "Only STREAM mode is supported")
 	}
+	encoding := req.GetSubscribe().GetEncoding()
+	if err := checkEncoding(encoding); err != nil {
+		return status.Errorf(codes.Unimplemented, "%v", err)
+	}
+
+	policy := s.policy
+	if v := metadata.ValueFromIncomingContext(stream.Context(), policyMetadataKey); len(v) > 0 {
+		if policy, err = ParseSlowSubscriberPolicy(v[0]); err != nil {
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+
+	opts := streamOptions{encoding: encoding, policy: policy}
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		opts.remote = p.Addr.String()
+	}
+	return s.serve(stream.Context(), stream, opts)
+}
 
+// responseSender is the part of a subscribe stream used to deliver responses.
+// It is implemented by both gNMI Subscribe and dial-out Publish streams.
+type responseSender interface {
+	Send(*gnmipb.SubscribeResponse) error
+}
+
+// streamOptions describe how the AFT stream is delivered to one receiver.
+type streamOptions struct {
+	encoding gnmipb.Encoding
+	policy   SlowSubscriberPolicy
+	// match selects the updates sent to the receiver. Nil matches everything.
+	match func(api.AFTUpdate) bool
+	// remote describes the receiver for introspection.
+	remote string
+}
+
+func (o streamOptions) matches(update api.AFTUpdate) bool {
+	return o.match == nil || o.match(update)
+}
+
+// serve registers a subscriber and streams the AFT to stream: a snapshot,
+// a sync_response and then incremental updates, until ctx is canceled or a
+// send fails.
+func (s *GNMIServer) serve(ctx context.Context, stream responseSender, opts streamOptions) error {
 	// Register subscriber
-	subChan := make(chan api.AFTUpdate, 100)
 	s.subMu.Lock()
 	s.subIDCounter++
-	id := s.subIDCounter
-	s.subscribers[id] = subChan
+	sub := newSubscriber(s.subIDCounter, s.queueSize, opts.policy)
+	label := strconv.FormatInt(sub.id, 10)
+	sub.remote = opts.remote
+	sub.sent = subscriberSent.With(label)
+	s.subscribers[sub.id] = sub
 	s.subMu.Unlock()
 
+	subscriberQueueDepth.Func(func() float64 { return float64(len(sub.ch)) }, label)
+	subscriberCount.Add(1)
+
 	defer func() {
 		s.subMu.Lock()
-		delete(s.subscribers, id)
-		close(subChan)
+		delete(s.subscribers, sub.id)
 		s.subMu.Unlock()
+		subscriberCount.Add(-1)
+		subscriberSent.Delete(label)
+		subscriberQueueDepth.Delete(label)
 	}()
 
-	// Send initial snapshot
-	snapshot := s.fib.GetSnapshot()
-	for _, update := range snapshot {
-		notif, err := aftToNotification(update)
-		if err != nil {
-			continue
-		}
-		if err := stream.Send(&gnmipb.SubscribeResponse{
-			Response: &gnmipb.SubscribeResponse_Update{Update: notif},
-		}); err != nil {
-			return err
-		}
-	}
-
-	// Send SyncResponse
-	if err := stream.Send(&gnmipb.SubscribeResponse{
-		Response: &gnmipb.SubscribeResponse_SyncResponse{SyncResponse: true},
-	}); err != nil {
+	// Send initial snapshot. The subscriber is registered first, so every
+	// update after the snapshot is queued; anything at or below snapSeq is
+	// already reflected in the snapshot and is skipped.
+	b := newBatch()
+	snapSeq, err := s.sendSnapshot(stream, b, opts)
+	if err != nil {
 		return err
 	}
 
-	// Stream updates
+	// Stream updates. A batch is sent once it holds BatchSize entries or its
+	// oldest update has waited BatchLatencyMs.
+	batchLatency := time.Duration(s.cfg.BatchLatencyMs) * time.Millisecond
+	timer := time.NewTimer(batchLatency)
+	timer.Stop()
+	defer timer.Stop()
 	for {
 		select {
-		case update := <-subChan:
-			notif, err := aftToNotification(update)
-			if err != nil {
+		case update := <-sub.ch:
+			if update.Seq <= snapSeq || !opts.matches(update) {
+				continue
+			}
+			b.Add(update)
+			if b.Len() < s.cfg.BatchSize && batchLatency > 0 {
+				if b.Len() == 1 {
+					timer.Reset(batchLatency)
+				}
 				continue
 			}
-			if err := stream.Send(&gnmipb.SubscribeResponse{
-				Response: &gnmipb.SubscribeResponse_Update{Update: notif},
-			}); err != nil {
+			timer.Stop()
+			if err := sendUpdates(stream, b, opts.encoding, sub.sent); err != nil {
+				return err
+			}
+		case <-timer.C:
+			if err := sendUpdates(stream, b, opts.encoding, sub.sent); err != nil {
+				return err
+			}
+		case <-sub.resync:
+			// Discard everything queued before the overflow, then resume
+			// queueing and replace the client's view with a fresh snapshot.
+			timer.Stop()
+			b.Reset()
+			sub.drain()
+			sub.dirty.Store(false)
+			subscriberResyncs.Inc()
+			if snapSeq, err = s.sendResync(stream, b, opts); err != nil {
 				return err
 			}
-		case <-stream.Context().Done():
+		case <-sub.kicked:
+			return status.Errorf(codes.ResourceExhausted, "subscriber %d is too slow to keep up with AFT updates", sub.id)
+		case <-ctx.Done():
 			return nil
 		}
 	}
 }
 
-func aftToNotification(update api.AFTUpdate) (*gnmipb.Notification, error) {
-	ts := time.Now().UnixNano()
-
-	var path *gnmipb.Path
-	var val *gnmipb.TypedValue
-
-	switch update.EntryType {
-	case api.AFTEntryPrefix:
-		prefixStr := update.Prefix.String()
-		path = &gnmipb.Path{
-			Elem: []*gnmipb.PathElem{
-				{Name: "network-instances"},
-				{Name: "network-instance", Key: map[string]string{"name": api.NetworkInstanceDefault}},
-				{Name: "afts"},
-				{Name: "ipv4-unicast"},
-				{Name: "ipv4-entry", Key: map[string]string{"prefix": prefixStr}},
-				{Name: "state"},
-				{Name: "next-hop-group"},
-			},
+// sendSnapshot sends the current FIB contents, batched by size only,
+// followed by a sync_response. It returns the sequence number of the snapshot.
+func (s *GNMIServer) sendSnapshot(stream responseSender, b *batch, opts streamOptions) (uint64, error) {
+	snapshot, seq := s.fib.GetSnapshot()
+	for _, update := range snapshot {
+		if !opts.matches(update) {
+			continue
 		}
-		val = &gnmipb.TypedValue{
-			Value: &gnmipb.TypedValue_UintVal{UintVal: update.NextHopGroup},
+		b.Add(update)
+		if b.Len() >= s.cfg.BatchSize {
+			if err := sendNotifications(stream, b.Flush(opts.encoding)...); err != nil {
+				return 0, err
+			}
 		}
+	}
+	if err := sendNotifications(stream, b.Flush(opts.encoding)...); err != nil {
+		return 0, err
+	}
 
-	case api.AFTEntryNextHopGroup:
-		path = &gnmipb.Path{
-			Elem: []*gnmipb.PathElem{
-				{Name: "network-instances"},
-				{Name: "network-instance", Key: map[string]string{"name": api.NetworkInstanceDefault}},
-				{Name: "afts"},
-				{Name: "next-hop-groups"},
-				{Name: "next-hop-group", Key: map[string]string{"id": fmt.Sprintf("%d", update.NextHopGroup)}},
-				{Name: "next-hops"},
-				{Name: "next-hop", Key: map[string]string{"index": fmt.Sprintf("%d", update.NextHopGroup)}}, // Assuming index matches NHG ID for simplicity, or use IP string. Let's use IP string as index.
-				// Wait, the NextHop index should be the IP address string to match the NextHop entry.
-				// Let's use the NextHop IP string as the index in the NHG.
-			},
-		}
-		// Correcting the path for NHG -> NH reference
-		path.Elem[len(path.Elem)-1].Key["index"] = update.NextHop.String()
-		
-		// The value for a next-hop within a next-hop-group is typically its weight.
-		// For simplicity, we can just set weight to 1.
-		// Actually, the path should be to the `weight` leaf if we are setting a value,
-		// or we can just send an empty update to the list element to indicate it exists.
-		// Let's set the weight leaf.
-		path.Elem = append(path.Elem, &gnmipb.PathElem{Name: "state"}, &gnmipb.PathElem{Name: "weight"})
-		val = &gnmipb.TypedValue{
-			Value: &gnmipb.TypedValue_UintVal{UintVal: 1},
-		}
+	// Send SyncResponse
+	return seq, stream.Send(&gnmipb.SubscribeResponse{
+		Response: &gnmipb.SubscribeResponse_SyncResponse{SyncResponse: true},
+	})
+}
 
-	case api.AFTEntryNextHop:
-		path = &gnmipb.Path{
-			Elem: []*gnmipb.PathElem{
-				{Name: "network-instances"},
-				{Name: "network-instance", Key: map[string]string{"name": api.NetworkInstanceDefault}},
-				{Name: "afts"},
-				{Name: "next-hops"},
-				{Name: "next-hop", Key: map[string]string{"index": update.NextHop.String()}},
-				{Name: "state"},
-				{Name: "ip-address"},
-			},
-		}
-		val = &gnmipb.TypedValue{
-			Value: &gnmipb.TypedValue_StringVal{StringVal: update.NextHop.String()},
-		}
+// sendResync deletes the whole AFT from the receiver's view and sends a fresh
+// snapshot. It returns the sequence number of the snapshot.
+func (s *GNMIServer) sendResync(stream responseSender, b *batch, opts streamOptions) (uint64, error) {
+	notif := newAFTNotification(time.Now())
+	notif.Delete = []*gnmipb.Path{{}}
+	if err := sendNotifications(stream, notif); err != nil {
+		return 0, err
+	}
+	return s.sendSnapshot(stream, b, opts)
+}
 
-	default:
-		return nil, fmt.Errorf("unknown AFT entry type: %v", update.EntryType)
+// sendUpdates flushes b to stream, counts the updates it carried in sent
+// and records their gNMI send latency.
+func sendUpdates(stream responseSender, b *batch, enc gnmipb.Encoding, sent *metrics.Counter) error {
+	emitted := b.EventTimes()
+	if err := sendNotifications(stream, b.Flush(enc)...); err != nil {
+		return err
+	}
+	sent.Add(uint64(len(emitted)))
+	for _, ts := range emitted {
+		latency.Observe(latency.StageGNMI, ts)
 	}
+	return nil
+}
 
-	if update.Action == api.Delete {
-		// For deletes, we typically delete the list element itself, not just the leaf.
-		// So we need to trim the path back to the list element.
-		switch update.EntryType {
-		case api.AFTEntryPrefix:
-			path.Elem = path.Elem[:len(path.Elem)-2] // Remove state/next-hop-group
-		case api.AFTEntryNextHopGroup:
-			path.Elem = path.Elem[:len(path.Elem)-5] // Remove next-hops/next-hop/state/weight
-		case api.AFTEntryNextHop:
-			path.Elem = path.Elem[:len(path.Elem)-2] // Remove state/ip-address
+// sendNotifications sends each of notifs as an update response.
+func sendNotifications(stream responseSender, notifs ...*gnmipb.Notification) error {
+	for _, notif := range notifs {
+		err := stream.Send(&gnmipb.SubscribeResponse{
+			Response: &gnmipb.SubscribeResponse_Update{Update: notif},
+		})
+		if err != nil {
+			return err
 		}
-
-		return &gnmipb.Notification{
-			Timestamp: ts,
-			Delete:    []*gnmipb.Path{path},
-		}, nil
-	}
-
-	return &gnmipb.Notification{
-		Timestamp: ts,
-		Update: []*gnmipb.Update{
-			{
-				Path: path,
-				Val:  val,
-			},
-		},
-	}, nil
+	}
+	return nil
 }
@@ -0,0 +1,156 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/fib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// startServer serves s over an in-memory listener and returns a connected client.
+func startServer(t *testing.T, s *GNMIServer) gnmipb.GNMIClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	gnmipb.RegisterGNMIServer(gs, s)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return gnmipb.NewGNMIClient(conn)
+}
+
+func subscribe(t *testing.T, ctx context.Context, client gnmipb.GNMIClient) gnmipb.GNMI_SubscribeClient {
+	t.Helper()
+	stream, err := client.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := stream.Send(&gnmipb.SubscribeRequest{
+		Request: &gnmipb.SubscribeRequest_Subscribe{Subscribe: &gnmipb.SubscriptionList{
+			Mode:     gnmipb.SubscriptionList_STREAM,
+			Encoding: gnmipb.Encoding_PROTO,
+		}},
+	}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	return stream
+}
+
+// ipv4Entries returns the prefixes of the ipv4-entry updates in notif.
+func ipv4Entries(notif *gnmipb.Notification) []string {
+	var prefixes []string
+	for _, u := range notif.GetUpdate() {
+		elems := u.GetPath().GetElem()
+		if len(elems) == 3 && elems[1].GetName() == "ipv4-entry" && elems[2].GetName() == "prefix" {
+			prefixes = append(prefixes, u.GetVal().GetStringVal())
+		}
+	}
+	return prefixes
+}
+
+func TestSubscribe_SnapshotHandoff(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 100)
+	f := fib.New(telemetryChan)
+	s := New(f, telemetryChan, nil, config.TelemetryConfig{BatchSize: 1})
+	client := startServer(t, s)
+
+	// These updates are still queued in telemetryChan when the client
+	// subscribes, so they reach it both in the snapshot and in the stream.
+	nh := netip.MustParseAddr("192.168.1.1")
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/24"), NextHop: nh})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := subscribe(t, ctx, client)
+
+	var snapshot []string
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if resp.GetSyncResponse() {
+			break
+		}
+		snapshot = append(snapshot, ipv4Entries(resp.GetUpdate())...)
+	}
+	if len(snapshot) != 1 || snapshot[0] != "10.0.0.0/24" {
+		t.Fatalf("Unexpected snapshot %v", snapshot)
+	}
+
+	go s.Run(ctx)
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.1.0/24"), NextHop: nh})
+
+	// The first streamed prefix must be the new one, not a replay of the
+	// snapshot content.
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if prefixes := ipv4Entries(resp.GetUpdate()); len(prefixes) > 0 {
+			if prefixes[0] != "10.0.1.0/24" {
+				t.Errorf("Expected 10.0.1.0/24, got replayed %v", prefixes)
+			}
+			return
+		}
+	}
+}
+
+func TestSubscribe_SnapshotTimestamps(t *testing.T) {
+	telemetryChan := make(chan api.AFTUpdate, 100)
+	f := fib.New(telemetryChan)
+	s := New(f, telemetryChan, nil, config.TelemetryConfig{BatchSize: 100})
+	client := startServer(t, s)
+
+	nh := netip.MustParseAddr("192.168.1.1")
+	t1, t2 := time.Unix(1000, 0), time.Unix(2000, 0)
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.0.0/24"), NextHop: nh, Timestamp: t1})
+	f.Update(api.FIBUpdate{Action: api.Add, Prefix: netip.MustParsePrefix("10.0.1.0/24"), NextHop: nh, Timestamp: t2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := subscribe(t, ctx, client)
+
+	// Both entries fit in one batch, but each is stamped with its own last
+	// change time.
+	want := map[string]int64{"10.0.0.0/24": t1.UnixNano(), "10.0.1.0/24": t2.UnixNano()}
+	got := map[string]int64{}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if resp.GetSyncResponse() {
+			break
+		}
+		for _, prefix := range ipv4Entries(resp.GetUpdate()) {
+			got[prefix] = resp.GetUpdate().GetTimestamp()
+		}
+	}
+	for prefix, ts := range want {
+		if got[prefix] != ts {
+			t.Errorf("Expected %s at %d, got %d", prefix, ts, got[prefix])
+		}
+	}
+}
@@ -0,0 +1,768 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/pipeline"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// The simulator exposes a writable configuration subtree rooted at
+// /simulator. Set operations against it are translated into RIB updates:
+//
+//	/simulator/static-routes/static-route[prefix=P]/config/{next-hop,interface,pushed-mpls-label-stack,metric}
+//	/simulator/mpls/label-entry[label=L]/config/{next-hop,interface,pushed-mpls-label-stack,metric}
+//	/simulator/interfaces/interface[name=N]/config/{address,enabled}
+//	/simulator/next-hops/next-hop[address=A]/config/enabled
+//
+// Static routes and MPLS label entries are injected with
+// api.ProtocolStatic. The next-hop of a static route is an IP address, DROP
+// to discard the traffic or RECEIVE to punt it to the CPU; a route with an
+// interface instead of a next-hop is an interface-only route. The next hop
+// pushes pushed-mpls-label-stack, if set. A label entry pops its label, so
+// it swaps the label if it pushes others and pops it otherwise. Disabling an
+// interface marks every next hop within its address subnet, and every
+// interface next hop of the interface, as unreachable; disabling a next hop
+// marks that single address as unreachable.
+const simRoot = "simulator"
+
+// staticRouteAdminDist is the administrative distance of static routes
+// configured through gNMI Set.
+const staticRouteAdminDist = 1
+
+// SetInstaller is the installer name of static routes configured through
+// gNMI Set, which selects their import policy.
+const SetInstaller = "gnmi"
+
+// simLists maps each keyed list in the simulator subtree to its key leaf.
+var simLists = map[string]string{
+	"static-route": "prefix",
+	"label-entry":  "label",
+	"interface":    "name",
+	"next-hop":     "address",
+}
+
+// simListParents maps each keyed list to its enclosing container.
+var simListParents = map[string]string{
+	"static-route": "static-routes",
+	"label-entry":  "mpls",
+	"interface":    "interfaces",
+	"next-hop":     "next-hops",
+}
+
+// staticRoute is a static route or MPLS label entry.
+type staticRoute struct {
+	NextHop     netip.Addr
+	NextHopType api.NextHopType // NextHopIP unless next-hop is DROP or RECEIVE.
+	Interface   string
+	// PushedLabels is the pushed label stack, formatted by
+	// api.LabelStack.String to keep staticRoute comparable.
+	PushedLabels string
+	Metric       uint32
+}
+
+// nextHopType returns the type of the next hop of r.
+func (r staticRoute) nextHopType() api.NextHopType {
+	if r.NextHopType == api.NextHopIP && !r.NextHop.IsValid() && r.Interface != "" {
+		return api.NextHopInterface
+	}
+	return r.NextHopType
+}
+
+// update returns the RIB update adding r as the route to prefix or, if label
+// is non-zero, the label entry of label.
+func (r staticRoute) update(prefix netip.Prefix, label uint32) api.RIBUpdate {
+	pushed, _ := api.ParseLabelStack(r.PushedLabels)
+	return api.RIBUpdate{
+		Action:       api.Add,
+		Protocol:     api.ProtocolStatic,
+		Installer:    SetInstaller,
+		Prefix:       prefix,
+		Label:        label,
+		NextHop:      r.NextHop,
+		NextHopType:  r.nextHopType(),
+		Interface:    r.Interface,
+		PushedLabels: pushed,
+		Metric:       r.Metric,
+		AdminDist:    staticRouteAdminDist,
+	}
+}
+
+// validate reports whether r has a next hop.
+func (r staticRoute) validate() error {
+	hasNextHop := r.NextHop.IsValid() || r.NextHopType != api.NextHopIP
+	switch {
+	case !hasNextHop && r.Interface == "":
+		return errors.New("no next-hop or interface")
+	case hasNextHop && r.Interface != "":
+		return errors.New("both a next-hop and an interface")
+	}
+	return nil
+}
+
+// setLeaf applies the value of a config leaf of r.
+func (r *staticRoute) setLeaf(leaf string, val any) error {
+	var err error
+	switch leaf {
+	case "next-hop":
+		s, err := asString(val)
+		if err != nil {
+			return err
+		}
+		if r.NextHop, r.NextHopType, err = parseNextHop(s); err != nil {
+			return err
+		}
+	case "interface":
+		if r.Interface, err = asString(val); err != nil {
+			return err
+		}
+	case "pushed-mpls-label-stack":
+		labels, err := asLabelStack(val)
+		if err != nil {
+			return err
+		}
+		r.PushedLabels = labels.String()
+	case "metric":
+		if r.Metric, err = asUint32(val); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown leaf %q", leaf)
+	}
+	return nil
+}
+
+// resetLeaf resets a config leaf of r to its default.
+func (r *staticRoute) resetLeaf(leaf string) error {
+	switch leaf {
+	case "next-hop":
+		r.NextHop, r.NextHopType = netip.Addr{}, api.NextHopIP
+	case "interface":
+		r.Interface = ""
+	case "pushed-mpls-label-stack":
+		r.PushedLabels = ""
+	case "metric":
+		r.Metric = 0
+	default:
+		return fmt.Errorf("unknown leaf %q", leaf)
+	}
+	return nil
+}
+
+type simInterface struct {
+	Address netip.Prefix
+	Enabled bool
+}
+
+// simState is the configuration held in the /simulator subtree.
+type simState struct {
+	staticRoutes map[netip.Prefix]staticRoute
+	labelEntries map[uint32]staticRoute
+	interfaces   map[string]simInterface
+	nextHops     map[netip.Addr]bool // Value is the enabled state.
+}
+
+func newSimState() *simState {
+	return &simState{
+		staticRoutes: make(map[netip.Prefix]staticRoute),
+		labelEntries: make(map[uint32]staticRoute),
+		interfaces:   make(map[string]simInterface),
+		nextHops:     make(map[netip.Addr]bool),
+	}
+}
+
+func (st *simState) clone() *simState {
+	c := newSimState()
+	for k, v := range st.staticRoutes {
+		c.staticRoutes[k] = v
+	}
+	for k, v := range st.labelEntries {
+		c.labelEntries[k] = v
+	}
+	for k, v := range st.interfaces {
+		c.interfaces[k] = v
+	}
+	for k, v := range st.nextHops {
+		c.nextHops[k] = v
+	}
+	return c
+}
+
+// downRanges returns the set of next-hop ranges that are unreachable in this state.
+func (st *simState) downRanges() map[netip.Prefix]struct{} {
+	down := make(map[netip.Prefix]struct{})
+	for _, intf := range st.interfaces {
+		if !intf.Enabled && intf.Address.IsValid() {
+			down[intf.Address.Masked()] = struct{}{}
+		}
+	}
+	for addr, enabled := range st.nextHops {
+		if !enabled {
+			down[netip.PrefixFrom(addr, addr.BitLen())] = struct{}{}
+		}
+	}
+	return down
+}
+
+// downInterfaces returns the set of interfaces that are disabled in this
+// state.
+func (st *simState) downInterfaces() map[string]struct{} {
+	down := make(map[string]struct{})
+	for name, intf := range st.interfaces {
+		if !intf.Enabled {
+			down[name] = struct{}{}
+		}
+	}
+	return down
+}
+
+func (st *simState) validate() error {
+	for prefix, route := range st.staticRoutes {
+		if err := route.validate(); err != nil {
+			return fmt.Errorf("static route %s has %v", prefix, err)
+		}
+	}
+	for label, entry := range st.labelEntries {
+		if err := entry.validate(); err != nil {
+			return fmt.Errorf("label entry %d has %v", label, err)
+		}
+	}
+	return nil
+}
+
+// Set implements the gNMI Set RPC for the /simulator subtree.
+// The request is applied atomically: if any operation fails, no change is made.
+// Room for all of its RIB updates is reserved before the first is sent, so
+// the request fails before changing the RIB if the pipeline has no room.
+func (s *GNMIServer) Set(ctx context.Context, req *gnmipb.SetRequest) (*gnmipb.SetResponse, error) {
+	if len(req.GetUnionReplace()) > 0 {
+		return nil, status.Errorf(codes.Unimplemented, "union_replace is not supported")
+	}
+
+	s.setMu.Lock()
+	defer s.setMu.Unlock()
+
+	next := s.sim.clone()
+	var results []*gnmipb.UpdateResult
+
+	for _, p := range req.GetDelete() {
+		elems, err := simPath(req.GetPrefix(), p)
+		if err != nil {
+			return nil, err
+		}
+		if err := next.delete(elems); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "delete %s: %v", PathString(p), err)
+		}
+		results = append(results, &gnmipb.UpdateResult{Path: p, Op: gnmipb.UpdateResult_DELETE})
+	}
+	for _, u := range req.GetReplace() {
+		elems, err := simPath(req.GetPrefix(), u.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		if err := next.delete(elems); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "replace %s: %v", PathString(u.GetPath()), err)
+		}
+		if err := next.update(elems, u.GetVal()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "replace %s: %v", PathString(u.GetPath()), err)
+		}
+		results = append(results, &gnmipb.UpdateResult{Path: u.GetPath(), Op: gnmipb.UpdateResult_REPLACE})
+	}
+	for _, u := range req.GetUpdate() {
+		elems, err := simPath(req.GetPrefix(), u.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		if err := next.update(elems, u.GetVal()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "update %s: %v", PathString(u.GetPath()), err)
+		}
+		results = append(results, &gnmipb.UpdateResult{Path: u.GetPath(), Op: gnmipb.UpdateResult_UPDATE})
+	}
+
+	if err := next.validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	updates := simDiff(s.sim, next)
+	if err := pipeline.Reserve(ctx, s.ribChan, len(updates)); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to inject updates: %v", err)
+	}
+	now := time.Now()
+	for _, u := range updates {
+		u.Timestamp = now
+		pipeline.Send(s.ribChan, u, "rib")
+	}
+	s.sim = next
+
+	return &gnmipb.SetResponse{
+		Prefix:    req.GetPrefix(),
+		Response:  results,
+		Timestamp: time.Now().UnixNano(),
+	}, nil
+}
+
+// simDiff returns the RIB updates needed to move from prev to next.
+func simDiff(prev, next *simState) []api.RIBUpdate {
+	var updates []api.RIBUpdate
+
+	for prefix, route := range prev.staticRoutes {
+		if _, ok := next.staticRoutes[prefix]; !ok {
+			updates = append(updates, api.RIBUpdate{
+				Action:   api.Delete,
+				Protocol: api.ProtocolStatic,
+				Prefix:   prefix,
+				NextHop:  route.NextHop,
+			})
+		}
+	}
+	for prefix, route := range next.staticRoutes {
+		if old, ok := prev.staticRoutes[prefix]; ok && old == route {
+			continue
+		}
+		updates = append(updates, route.update(prefix, 0))
+	}
+	for label := range prev.labelEntries {
+		if _, ok := next.labelEntries[label]; !ok {
+			updates = append(updates, api.RIBUpdate{
+				Action:   api.Delete,
+				Protocol: api.ProtocolStatic,
+				Label:    label,
+			})
+		}
+	}
+	for label, entry := range next.labelEntries {
+		if old, ok := prev.labelEntries[label]; ok && old == entry {
+			continue
+		}
+		updates = append(updates, entry.update(netip.Prefix{}, label))
+	}
+
+	prevDown, nextDown := prev.downRanges(), next.downRanges()
+	for nhRange := range prevDown {
+		if _, ok := nextDown[nhRange]; !ok {
+			updates = append(updates, api.RIBUpdate{Action: api.NextHopUp, Prefix: nhRange})
+		}
+	}
+	for nhRange := range nextDown {
+		if _, ok := prevDown[nhRange]; !ok {
+			updates = append(updates, api.RIBUpdate{Action: api.NextHopDown, Prefix: nhRange})
+		}
+	}
+	prevIntfs, nextIntfs := prev.downInterfaces(), next.downInterfaces()
+	for name := range prevIntfs {
+		if _, ok := nextIntfs[name]; !ok {
+			updates = append(updates, api.RIBUpdate{Action: api.NextHopUp, Interface: name})
+		}
+	}
+	for name := range nextIntfs {
+		if _, ok := prevIntfs[name]; !ok {
+			updates = append(updates, api.RIBUpdate{Action: api.NextHopDown, Interface: name})
+		}
+	}
+
+	return updates
+}
+
+// simPath joins prefix and p and returns the elements below the /simulator root.
+func simPath(prefix, p *gnmipb.Path) ([]*gnmipb.PathElem, error) {
+	elems := append(append([]*gnmipb.PathElem{}, prefix.GetElem()...), p.GetElem()...)
+	if len(elems) == 0 || elems[0].GetName() != simRoot {
+		return nil, status.Errorf(codes.InvalidArgument, "path %s is not writable, only /%s is supported", PathString(p), simRoot)
+	}
+	return elems[1:], nil
+}
+
+// delete removes the subtree at elems, resetting leaves to their defaults.
+func (st *simState) delete(elems []*gnmipb.PathElem) error {
+	if len(elems) == 0 {
+		*st = *newSimState()
+		return nil
+	}
+	switch elems[0].GetName() {
+	case "static-routes":
+		return deleteEntries(st.staticRoutes, elems[1:], "static-route", parsePrefix, (*staticRoute).resetLeaf)
+	case "mpls":
+		return deleteEntries(st.labelEntries, elems[1:], "label-entry", parseLabel, (*staticRoute).resetLeaf)
+	case "interfaces":
+		return deleteEntries(st.interfaces, elems[1:], "interface", parseName, func(i *simInterface, leaf string) error {
+			switch leaf {
+			case "address":
+				i.Address = netip.Prefix{}
+			case "enabled":
+				i.Enabled = true
+			default:
+				return fmt.Errorf("unknown leaf %q", leaf)
+			}
+			return nil
+		})
+	case "next-hops":
+		return deleteEntries(st.nextHops, elems[1:], "next-hop", netip.ParseAddr, func(enabled *bool, leaf string) error {
+			if leaf != "enabled" {
+				return fmt.Errorf("unknown leaf %q", leaf)
+			}
+			*enabled = true
+			return nil
+		})
+	}
+	return fmt.Errorf("unknown container %q", elems[0].GetName())
+}
+
+// deleteEntries handles deletion at or below a keyed list container.
+// elems are the elements after the container, e.g. [static-route[prefix=...], config, metric].
+func deleteEntries[K comparable, V any](m map[K]V, elems []*gnmipb.PathElem, list string, parseKey func(string) (K, error), resetLeaf func(*V, string) error) error {
+	if len(elems) == 0 {
+		clear(m)
+		return nil
+	}
+	if elems[0].GetName() != list {
+		return fmt.Errorf("unknown list %q", elems[0].GetName())
+	}
+	keyStr, ok := elems[0].GetKey()[simLists[list]]
+	if !ok {
+		clear(m)
+		return nil
+	}
+	key, err := parseKey(keyStr)
+	if err != nil {
+		return err
+	}
+	if len(elems) == 1 {
+		delete(m, key)
+		return nil
+	}
+	v, ok := m[key]
+	if !ok {
+		// Deleting a non-existent node is not an error.
+		return nil
+	}
+	if len(elems) != 3 || elems[1].GetName() != "config" {
+		return fmt.Errorf("unsupported path below %s", list)
+	}
+	if err := resetLeaf(&v, elems[2].GetName()); err != nil {
+		return err
+	}
+	m[key] = v
+	return nil
+}
+
+// update merges val into the subtree at elems.
+func (st *simState) update(elems []*gnmipb.PathElem, val *gnmipb.TypedValue) error {
+	var leaves []simLeaf
+	switch v := val.GetValue().(type) {
+	case *gnmipb.TypedValue_JsonIetfVal:
+		var tree any
+		if err := json.Unmarshal(v.JsonIetfVal, &tree); err != nil {
+			return fmt.Errorf("invalid JSON value: %v", err)
+		}
+		if err := flattenJSON(elems, tree, &leaves); err != nil {
+			return err
+		}
+	case *gnmipb.TypedValue_JsonVal:
+		var tree any
+		if err := json.Unmarshal(v.JsonVal, &tree); err != nil {
+			return fmt.Errorf("invalid JSON value: %v", err)
+		}
+		if err := flattenJSON(elems, tree, &leaves); err != nil {
+			return err
+		}
+	case *gnmipb.TypedValue_StringVal:
+		leaves = append(leaves, simLeaf{elems, v.StringVal})
+	case *gnmipb.TypedValue_UintVal:
+		leaves = append(leaves, simLeaf{elems, v.UintVal})
+	case *gnmipb.TypedValue_IntVal:
+		leaves = append(leaves, simLeaf{elems, v.IntVal})
+	case *gnmipb.TypedValue_BoolVal:
+		leaves = append(leaves, simLeaf{elems, v.BoolVal})
+	case *gnmipb.TypedValue_LeaflistVal:
+		var list []any
+		for _, e := range v.LeaflistVal.GetElement() {
+			switch ev := e.GetValue().(type) {
+			case *gnmipb.TypedValue_UintVal:
+				list = append(list, ev.UintVal)
+			case *gnmipb.TypedValue_IntVal:
+				list = append(list, ev.IntVal)
+			default:
+				return fmt.Errorf("unsupported leaf-list element type %T", ev)
+			}
+		}
+		leaves = append(leaves, simLeaf{elems, list})
+	default:
+		return fmt.Errorf("unsupported value type %T", v)
+	}
+
+	for _, l := range leaves {
+		if err := st.setLeaf(l.elems, l.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// simLeaf is a single leaf value addressed relative to the /simulator root.
+type simLeaf struct {
+	elems []*gnmipb.PathElem
+	val   any
+}
+
+// flattenJSON converts a JSON tree rooted at base into individual leaves.
+// Lists are expected as JSON arrays whose members carry their key leaf.
+func flattenJSON(base []*gnmipb.PathElem, tree any, out *[]simLeaf) error {
+	obj, ok := tree.(map[string]any)
+	if !ok {
+		*out = append(*out, simLeaf{base, tree})
+		return nil
+	}
+	// Sort names so that errors are reported deterministically.
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := obj[name]
+		// Strip any JSON_IETF module qualifier, e.g. "aft-simulator:static-routes".
+		if i := strings.LastIndex(name, ":"); i >= 0 {
+			name = name[i+1:]
+		}
+		keyName, isList := simLists[name]
+		isList = isList && len(base) > 0 && base[len(base)-1].GetName() == simListParents[name]
+		if !isList {
+			if len(base) > 0 && isKeyLeaf(base[len(base)-1], name) {
+				// The key is already part of the path.
+				continue
+			}
+			elems := append(append([]*gnmipb.PathElem{}, base...), &gnmipb.PathElem{Name: name})
+			if err := flattenJSON(elems, child, out); err != nil {
+				return err
+			}
+			continue
+		}
+		items, ok := child.([]any)
+		if !ok {
+			return fmt.Errorf("list %q must be a JSON array", name)
+		}
+		for _, item := range items {
+			entry, ok := item.(map[string]any)
+			if !ok {
+				return fmt.Errorf("list %q member must be a JSON object", name)
+			}
+			var key string
+			switch k := entry[keyName].(type) {
+			case string:
+				key = k
+			case float64: // Numeric keys, such as labels.
+				key = strconv.FormatFloat(k, 'f', -1, 64)
+			default:
+				return fmt.Errorf("list %q member is missing key %q", name, keyName)
+			}
+			elems := append(append([]*gnmipb.PathElem{}, base...), &gnmipb.PathElem{Name: name, Key: map[string]string{keyName: key}})
+			if err := flattenJSON(elems, entry, out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isKeyLeaf reports whether name is the key leaf of the list entry elem.
+func isKeyLeaf(elem *gnmipb.PathElem, name string) bool {
+	keyName, ok := simLists[elem.GetName()]
+	return ok && keyName == name && len(elem.GetKey()) > 0
+}
+
+// setLeaf applies a single leaf value.
+func (st *simState) setLeaf(elems []*gnmipb.PathElem, val any) error {
+	if len(elems) != 4 || elems[2].GetName() != "config" {
+		return fmt.Errorf("path %s does not address a config leaf", elemsString(elems))
+	}
+	entry, leaf := elems[1], elems[3].GetName()
+	keyStr, ok := entry.GetKey()[simLists[entry.GetName()]]
+	if !ok {
+		return fmt.Errorf("%s requires key %q", entry.GetName(), simLists[entry.GetName()])
+	}
+
+	switch elems[0].GetName() + "/" + entry.GetName() {
+	case "static-routes/static-route":
+		prefix, err := parsePrefix(keyStr)
+		if err != nil {
+			return err
+		}
+		route := st.staticRoutes[prefix]
+		// The prefix key leaf is already set from the path.
+		if leaf != "prefix" {
+			if err := route.setLeaf(leaf, val); err != nil {
+				return err
+			}
+		}
+		st.staticRoutes[prefix] = route
+
+	case "mpls/label-entry":
+		label, err := parseLabel(keyStr)
+		if err != nil {
+			return err
+		}
+		entry := st.labelEntries[label]
+		if leaf != "label" {
+			if err := entry.setLeaf(leaf, val); err != nil {
+				return err
+			}
+		}
+		st.labelEntries[label] = entry
+
+	case "interfaces/interface":
+		name, _ := parseName(keyStr)
+		intf, exists := st.interfaces[name]
+		if !exists {
+			intf.Enabled = true
+		}
+		switch leaf {
+		case "name":
+		case "address":
+			s, err := asString(val)
+			if err != nil {
+				return err
+			}
+			if intf.Address, err = netip.ParsePrefix(s); err != nil {
+				return err
+			}
+		case "enabled":
+			b, err := asBool(val)
+			if err != nil {
+				return err
+			}
+			intf.Enabled = b
+		default:
+			return fmt.Errorf("unknown leaf %q", leaf)
+		}
+		st.interfaces[name] = intf
+
+	case "next-hops/next-hop":
+		addr, err := netip.ParseAddr(keyStr)
+		if err != nil {
+			return err
+		}
+		enabled, exists := st.nextHops[addr]
+		if !exists {
+			enabled = true
+		}
+		switch leaf {
+		case "address":
+		case "enabled":
+			if enabled, err = asBool(val); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown leaf %q", leaf)
+		}
+		st.nextHops[addr] = enabled
+
+	default:
+		return fmt.Errorf("unknown list %s", elemsString(elems[:2]))
+	}
+	return nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
+
+// parseNextHop parses the next-hop leaf of a static route: an IP address,
+// DROP or RECEIVE.
+func parseNextHop(s string) (netip.Addr, api.NextHopType, error) {
+	switch typ := api.NextHopType(s); typ {
+	case api.NextHopDrop, api.NextHopReceive:
+		return netip.Addr{}, typ, nil
+	}
+	addr, err := netip.ParseAddr(s)
+	return addr, api.NextHopIP, err
+}
+
+// parseLabel parses the incoming label of a label entry.
+func parseLabel(s string) (uint32, error) {
+	label, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || label < api.MinLabel || label > api.MaxLabel {
+		return 0, fmt.Errorf("invalid label %q, want %d to %d", s, api.MinLabel, api.MaxLabel)
+	}
+	return uint32(label), nil
+}
+
+func parseName(s string) (string, error) {
+	return s, nil
+}
+
+func asString(val any) (string, error) {
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("expected string value, got %T", val)
+	}
+	return s, nil
+}
+
+func asUint32(val any) (uint32, error) {
+	switch v := val.(type) {
+	case uint64:
+		if v <= 1<<32-1 {
+			return uint32(v), nil
+		}
+	case int64:
+		if v >= 0 && v <= 1<<32-1 {
+			return uint32(v), nil
+		}
+	case float64: // JSON numbers.
+		if v >= 0 && v <= 1<<32-1 && v == float64(uint32(v)) {
+			return uint32(v), nil
+		}
+	default:
+		return 0, fmt.Errorf("expected unsigned integer value, got %T", val)
+	}
+	return 0, fmt.Errorf("value %v out of range for uint32", val)
+}
+
+// asLabelStack converts a leaf-list of labels, or a string formatted by
+// api.LabelStack.String, to a label stack.
+func asLabelStack(val any) (api.LabelStack, error) {
+	if s, ok := val.(string); ok {
+		return api.ParseLabelStack(s)
+	}
+	list, ok := val.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected leaf-list of labels, got %T", val)
+	}
+	var labels api.LabelStack
+	for _, v := range list {
+		label, err := asUint32(v)
+		if err != nil {
+			return nil, err
+		}
+		if label > api.MaxLabel {
+			return nil, fmt.Errorf("invalid MPLS label %d", label)
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+func asBool(val any) (bool, error) {
+	b, ok := val.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected boolean value, got %T", val)
+	}
+	return b, nil
+}
@@ -0,0 +1,341 @@
+package telemetry
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/config"
+	"github.com/openconfig/aft-simulator/pkg/rib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func simElems(elems ...*gnmipb.PathElem) *gnmipb.Path {
+	return &gnmipb.Path{Elem: append([]*gnmipb.PathElem{{Name: simRoot}}, elems...)}
+}
+
+func staticRoutePath(prefix string, leaf ...string) *gnmipb.Path {
+	elems := []*gnmipb.PathElem{
+		{Name: "static-routes"},
+		{Name: "static-route", Key: map[string]string{"prefix": prefix}},
+	}
+	for _, l := range leaf {
+		elems = append(elems, &gnmipb.PathElem{Name: l})
+	}
+	return simElems(elems...)
+}
+
+func TestSet_StaticRoute(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	s := New(nil, nil, ribChan, config.TelemetryConfig{})
+
+	_, err := s.Set(context.Background(), &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{{
+			Path: staticRoutePath("10.1.0.0/16"),
+			Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_JsonIetfVal{
+				JsonIetfVal: []byte(`{"config": {"next-hop": "192.168.1.1", "metric": 5}}`),
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	update := <-ribChan
+	if update.Action != api.Add || update.Protocol != api.ProtocolStatic ||
+		update.Prefix != netip.MustParsePrefix("10.1.0.0/16") ||
+		update.NextHop != netip.MustParseAddr("192.168.1.1") || update.Metric != 5 {
+		t.Errorf("Unexpected RIB update %+v", update)
+	}
+
+	// Updating a single leaf re-injects the route.
+	_, err = s.Set(context.Background(), &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{{
+			Path: staticRoutePath("10.1.0.0/16", "config", "metric"),
+			Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_UintVal{UintVal: 7}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if update := <-ribChan; update.Action != api.Add || update.Metric != 7 {
+		t.Errorf("Expected ADD with metric 7, got %+v", update)
+	}
+
+	// Deleting the list entry withdraws the route.
+	_, err = s.Set(context.Background(), &gnmipb.SetRequest{
+		Delete: []*gnmipb.Path{staticRoutePath("10.1.0.0/16")},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if update := <-ribChan; update.Action != api.Delete || update.Protocol != api.ProtocolStatic {
+		t.Errorf("Expected static DELETE, got %+v", update)
+	}
+}
+
+func TestSet_SpecialNextHops(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	s := New(nil, nil, ribChan, config.TelemetryConfig{})
+
+	_, err := s.Set(context.Background(), &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{
+			{
+				Path: staticRoutePath("10.1.0.0/16", "config", "next-hop"),
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "DROP"}},
+			},
+			{
+				Path: staticRoutePath("10.2.0.0/16", "config", "interface"),
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "eth0"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got := map[netip.Prefix]api.RIBUpdate{}
+	for range 2 {
+		update := <-ribChan
+		got[update.Prefix] = update
+	}
+	if u := got[netip.MustParsePrefix("10.1.0.0/16")]; u.NextHopType != api.NextHopDrop || u.NextHop.IsValid() {
+		t.Errorf("Expected a drop route, got %+v", u)
+	}
+	if u := got[netip.MustParsePrefix("10.2.0.0/16")]; u.NextHopType != api.NextHopInterface || u.Interface != "eth0" {
+		t.Errorf("Expected an interface route, got %+v", u)
+	}
+
+	// A route cannot have both a next-hop and an interface.
+	_, err = s.Set(context.Background(), &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{{
+			Path: staticRoutePath("10.2.0.0/16", "config", "next-hop"),
+			Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "RECEIVE"}},
+		}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestSet_LabelEntry(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	s := New(nil, nil, ribChan, config.TelemetryConfig{})
+
+	_, err := s.Set(context.Background(), &gnmipb.SetRequest{
+		Replace: []*gnmipb.Update{{
+			Path: simElems(&gnmipb.PathElem{Name: "mpls"}),
+			Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_JsonIetfVal{
+				JsonIetfVal: []byte(`{"label-entry": [{"label": 16001, "config": {"next-hop": "192.168.1.1", "pushed-mpls-label-stack": [16002, 16003]}}]}`),
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	update := <-ribChan
+	if update.Action != api.Add || update.Protocol != api.ProtocolStatic || update.Label != 16001 ||
+		update.NextHop != netip.MustParseAddr("192.168.1.1") || update.PushedLabels.String() != "16002/16003" {
+		t.Errorf("Unexpected RIB update %+v", update)
+	}
+
+	// Reserved labels cannot be configured.
+	_, err = s.Set(context.Background(), &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{{
+			Path: simElems(
+				&gnmipb.PathElem{Name: "mpls"},
+				&gnmipb.PathElem{Name: "label-entry", Key: map[string]string{"label": "3"}},
+				&gnmipb.PathElem{Name: "config"},
+				&gnmipb.PathElem{Name: "next-hop"},
+			),
+			Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "192.168.1.1"}},
+		}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+
+	_, err = s.Set(context.Background(), &gnmipb.SetRequest{
+		Delete: []*gnmipb.Path{simElems(&gnmipb.PathElem{Name: "mpls"})},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if update := <-ribChan; update.Action != api.Delete || update.Label != 16001 {
+		t.Errorf("Expected DELETE of label 16001, got %+v", update)
+	}
+}
+
+func TestSet_NextHopAndInterfaceState(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	s := New(nil, nil, ribChan, config.TelemetryConfig{})
+
+	_, err := s.Set(context.Background(), &gnmipb.SetRequest{
+		Replace: []*gnmipb.Update{{
+			Path: simElems(),
+			Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_JsonIetfVal{
+				JsonIetfVal: []byte(`{
+					"interfaces": {"interface": [{"name": "eth0", "config": {"address": "192.168.1.0/24", "enabled": false}}]},
+					"next-hops": {"next-hop": [{"address": "192.168.2.1", "config": {"enabled": false}}]}
+				}`),
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	down := map[netip.Prefix]bool{}
+	var downIntf string
+	for i := 0; i < 3; i++ {
+		update := <-ribChan
+		if update.Action != api.NextHopDown {
+			t.Fatalf("Expected NEXT_HOP_DOWN, got %+v", update)
+		}
+		if update.Interface != "" {
+			downIntf = update.Interface
+		} else {
+			down[update.Prefix] = true
+		}
+	}
+	if !down[netip.MustParsePrefix("192.168.1.0/24")] || !down[netip.MustParsePrefix("192.168.2.1/32")] || downIntf != "eth0" {
+		t.Errorf("Unexpected down ranges %v and interface %q", down, downIntf)
+	}
+
+	// Re-enabling the interface brings it and its subnet back up.
+	_, err = s.Set(context.Background(), &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{{
+			Path: simElems(
+				&gnmipb.PathElem{Name: "interfaces"},
+				&gnmipb.PathElem{Name: "interface", Key: map[string]string{"name": "eth0"}},
+				&gnmipb.PathElem{Name: "config"},
+				&gnmipb.PathElem{Name: "enabled"},
+			),
+			Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_BoolVal{BoolVal: true}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if update := <-ribChan; update.Action != api.NextHopUp || update.Prefix != netip.MustParsePrefix("192.168.1.0/24") {
+		t.Errorf("Expected NEXT_HOP_UP for 192.168.1.0/24, got %+v", update)
+	}
+	if update := <-ribChan; update.Action != api.NextHopUp || update.Interface != "eth0" {
+		t.Errorf("Expected NEXT_HOP_UP for eth0, got %+v", update)
+	}
+}
+
+func TestSet_InterfaceDownWithdrawsInterfaceRoutes(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	fibChan := make(chan api.FIBUpdate, 10)
+	s := New(nil, nil, ribChan, config.TelemetryConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rib.New(fibChan).Start(ctx, ribChan)
+
+	set := func(val string) {
+		t.Helper()
+		_, err := s.Set(context.Background(), &gnmipb.SetRequest{
+			Update: []*gnmipb.Update{{
+				Path: simElems(),
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(val)}},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	set(`{"static-routes": {"static-route": [{"prefix": "10.1.0.0/16", "config": {"interface": "eth0"}}]}}`)
+	if update := <-fibChan; update.Action != api.Add || update.Interface != "eth0" {
+		t.Fatalf("Expected ADD via eth0, got %+v", update)
+	}
+
+	set(`{"interfaces": {"interface": [{"name": "eth0", "config": {"enabled": false}}]}}`)
+	if update := <-fibChan; update.Action != api.Delete || update.Prefix != netip.MustParsePrefix("10.1.0.0/16") {
+		t.Errorf("Expected DELETE of 10.1.0.0/16, got %+v", update)
+	}
+
+	set(`{"interfaces": {"interface": [{"name": "eth0", "config": {"enabled": true}}]}}`)
+	if update := <-fibChan; update.Action != api.Add || update.Interface != "eth0" {
+		t.Errorf("Expected ADD via eth0, got %+v", update)
+	}
+}
+
+func TestSet_InvalidRequestIsAtomic(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 10)
+	s := New(nil, nil, ribChan, config.TelemetryConfig{})
+
+	_, err := s.Set(context.Background(), &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{
+			{
+				Path: staticRoutePath("10.2.0.0/16", "config", "next-hop"),
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "192.168.1.1"}},
+			},
+			{
+				// Static routes without a next hop are rejected.
+				Path: staticRoutePath("10.3.0.0/16", "config", "metric"),
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_UintVal{UintVal: 1}},
+			},
+		},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+	if len(ribChan) != 0 {
+		t.Errorf("Expected no RIB updates, got %d", len(ribChan))
+	}
+	if len(s.sim.staticRoutes) != 0 {
+		t.Errorf("Expected state to be unchanged, got %v", s.sim.staticRoutes)
+	}
+
+	_, err = s.Set(context.Background(), &gnmipb.SetRequest{
+		Delete: []*gnmipb.Path{{Elem: []*gnmipb.PathElem{{Name: "afts"}}}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for non-simulator path, got %v", err)
+	}
+}
+
+func TestSet_NoRoomSendsNothing(t *testing.T) {
+	ribChan := make(chan api.RIBUpdate, 2)
+	s := New(nil, nil, ribChan, config.TelemetryConfig{})
+	req := &gnmipb.SetRequest{
+		Update: []*gnmipb.Update{
+			{
+				Path: staticRoutePath("10.2.0.0/16", "config", "next-hop"),
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "192.168.1.1"}},
+			},
+			{
+				Path: staticRoutePath("10.3.0.0/16", "config", "next-hop"),
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "192.168.1.1"}},
+			},
+		},
+	}
+
+	// With room for only one of the two routes, the request fails against
+	// a canceled context before sending either.
+	ribChan <- api.RIBUpdate{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Set(ctx, req); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected Unavailable, got %v", err)
+	}
+	if len(ribChan) != 1 {
+		t.Errorf("Expected no RIB updates, got %d", len(ribChan)-1)
+	}
+	if len(s.sim.staticRoutes) != 0 {
+		t.Errorf("Expected state to be unchanged, got %v", s.sim.staticRoutes)
+	}
+
+	// Retrying once there is room sends both routes.
+	<-ribChan
+	if _, err := s.Set(context.Background(), req); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if len(ribChan) != 2 {
+		t.Errorf("Expected 2 RIB updates, got %d", len(ribChan))
+	}
+}
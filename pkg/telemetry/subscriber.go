@@ -0,0 +1,186 @@
+package telemetry
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+	"github.com/openconfig/aft-simulator/pkg/metrics"
+)
+
+// SlowSubscriberPolicy selects how the server reacts when a subscriber's
+// queue is full.
+type SlowSubscriberPolicy string
+
+const (
+	// PolicyBlock waits up to the configured timeout for queue space and
+	// disconnects the subscriber if none becomes available.
+	PolicyBlock SlowSubscriberPolicy = "block"
+	// PolicyDisconnect terminates the subscription with ResourceExhausted.
+	PolicyDisconnect SlowSubscriberPolicy = "disconnect"
+	// PolicyResync drops updates until the subscriber has drained its
+	// queue, then resends the full AFT followed by a sync_response.
+	PolicyResync SlowSubscriberPolicy = "resync"
+)
+
+// policyMetadataKey is the gRPC metadata key a client can use to override
+// the server's default SlowSubscriberPolicy for its subscription.
+const policyMetadataKey = "slow-subscriber-policy"
+
+// Defaults used when the corresponding config fields are unset.
+const (
+	defaultQueueSize    = 100
+	defaultBlockTimeout = time.Second
+)
+
+// ParseSlowSubscriberPolicy converts s into a SlowSubscriberPolicy.
+// An empty string selects PolicyResync.
+func ParseSlowSubscriberPolicy(s string) (SlowSubscriberPolicy, error) {
+	switch p := SlowSubscriberPolicy(s); p {
+	case "":
+		return PolicyResync, nil
+	case PolicyBlock, PolicyDisconnect, PolicyResync:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown slow subscriber policy %q", s)
+}
+
+var (
+	droppedUpdates = metrics.Default.CounterVec("aftsim_telemetry_dropped_updates_total",
+		"AFT updates not queued to a subscriber because its queue was full.", "policy")
+	subscriberResyncs = metrics.Default.Counter("aftsim_telemetry_subscriber_resyncs_total",
+		"Full resynchronisations sent to slow subscribers.")
+	subscriberKicks = metrics.Default.Counter("aftsim_telemetry_slow_subscriber_disconnects_total",
+		"Subscriptions terminated because the subscriber was too slow.")
+	subscriberCount = metrics.Default.Gauge("aftsim_telemetry_subscribers",
+		"Active telemetry receivers, including dial-out streams.")
+	subscriberSent = metrics.Default.CounterVec("aftsim_telemetry_subscriber_sent_updates_total",
+		"AFT updates sent to each active subscriber.", "subscriber")
+	subscriberQueueDepth = metrics.Default.GaugeVec("aftsim_telemetry_subscriber_queue_depth",
+		"Updates queued for each active subscriber.", "subscriber")
+)
+
+// subscriber is the fan-out state of a single Subscribe stream.
+type subscriber struct {
+	id     int64
+	ch     chan api.AFTUpdate
+	policy SlowSubscriberPolicy
+	remote string
+	// sent counts the updates delivered to the receiver.
+	sent *metrics.Counter
+
+	// dirty is set while updates are being dropped for a pending resync.
+	dirty atomic.Bool
+	// resync is signalled when dirty becomes set.
+	resync chan struct{}
+	// kicked is closed when the subscriber must be disconnected.
+	kicked   chan struct{}
+	kickOnce sync.Once
+}
+
+func newSubscriber(id int64, queueSize int, policy SlowSubscriberPolicy) *subscriber {
+	return &subscriber{
+		id:     id,
+		ch:     make(chan api.AFTUpdate, queueSize),
+		policy: policy,
+		resync: make(chan struct{}, 1),
+		kicked: make(chan struct{}),
+	}
+}
+
+// SubscriberInfo describes an active telemetry receiver.
+type SubscriberInfo struct {
+	ID         int64
+	Remote     string
+	Policy     SlowSubscriberPolicy
+	QueueDepth int
+	QueueSize  int
+	Sent       uint64
+}
+
+// Subscribers returns the active Subscribe and dial-out streams, sorted by ID.
+func (s *GNMIServer) Subscribers() []SubscriberInfo {
+	s.subMu.RLock()
+	defer s.subMu.RUnlock()
+
+	infos := make([]SubscriberInfo, 0, len(s.subscribers))
+	for _, sub := range s.subscribers {
+		infos = append(infos, SubscriberInfo{
+			ID:         sub.id,
+			Remote:     sub.remote,
+			Policy:     sub.policy,
+			QueueDepth: len(sub.ch),
+			QueueSize:  cap(sub.ch),
+			Sent:       sub.sent.Value(),
+		})
+	}
+	slices.SortFunc(infos, func(a, b SubscriberInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return infos
+}
+
+func (sub *subscriber) kick() {
+	sub.kickOnce.Do(func() {
+		subscriberKicks.Inc()
+		close(sub.kicked)
+	})
+}
+
+// enqueue delivers update to the subscriber, applying its policy if the
+// queue is full. blockTimeout bounds the wait of PolicyBlock.
+func (sub *subscriber) enqueue(update api.AFTUpdate, blockTimeout time.Duration) {
+	if sub.dirty.Load() {
+		// The pending resync will cover this update.
+		droppedUpdates.With(string(sub.policy)).Inc()
+		return
+	}
+	select {
+	case sub.ch <- update:
+		return
+	case <-sub.kicked:
+		return
+	default:
+	}
+
+	switch sub.policy {
+	case PolicyBlock:
+		timer := time.NewTimer(blockTimeout)
+		defer timer.Stop()
+		select {
+		case sub.ch <- update:
+			return
+		case <-sub.kicked:
+			return
+		case <-timer.C:
+		}
+		logger.Warn("Subscriber blocked, disconnecting", "subscriber", sub.id, "timeout", blockTimeout)
+		droppedUpdates.With(string(sub.policy)).Inc()
+		sub.kick()
+
+	case PolicyDisconnect:
+		logger.Warn("Subscriber queue full, disconnecting", "subscriber", sub.id)
+		droppedUpdates.With(string(sub.policy)).Inc()
+		sub.kick()
+
+	case PolicyResync:
+		droppedUpdates.With(string(sub.policy)).Inc()
+		if sub.dirty.CompareAndSwap(false, true) {
+			logger.Warn("Subscriber queue full, scheduling resync", "subscriber", sub.id)
+			sub.resync <- struct{}{}
+		}
+	}
+}
+
+// drain discards all queued updates.
+func (sub *subscriber) drain() {
+	for {
+		select {
+		case <-sub.ch:
+		default:
+			return
+		}
+	}
+}
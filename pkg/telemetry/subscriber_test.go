@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openconfig/aft-simulator/pkg/api"
+)
+
+func TestSubscriber_Enqueue(t *testing.T) {
+	update := api.AFTUpdate{Action: api.Add, EntryType: api.AFTEntryNextHop}
+
+	t.Run("resync", func(t *testing.T) {
+		sub := newSubscriber(1, 1, PolicyResync)
+		dropped := droppedUpdates.With(string(PolicyResync)).Value()
+		sub.enqueue(update, time.Millisecond)
+		sub.enqueue(update, time.Millisecond)
+		sub.enqueue(update, time.Millisecond)
+
+		if !sub.dirty.Load() {
+			t.Error("Expected subscriber to be marked dirty")
+		}
+		select {
+		case <-sub.resync:
+		default:
+			t.Error("Expected resync to be signalled")
+		}
+		if got := droppedUpdates.With(string(PolicyResync)).Value() - dropped; got != 2 {
+			t.Errorf("Expected 2 dropped updates, got %d", got)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		sub := newSubscriber(2, 1, PolicyDisconnect)
+		sub.enqueue(update, time.Millisecond)
+		sub.enqueue(update, time.Millisecond)
+		select {
+		case <-sub.kicked:
+		default:
+			t.Error("Expected subscriber to be disconnected")
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		sub := newSubscriber(3, 1, PolicyBlock)
+		sub.enqueue(update, time.Millisecond)
+
+		// A reader freeing space within the timeout unblocks the sender.
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			<-sub.ch
+		}()
+		sub.enqueue(update, time.Second)
+		select {
+		case <-sub.kicked:
+			t.Fatal("Expected subscriber to stay connected")
+		default:
+		}
+
+		// Without a reader the subscriber is disconnected after the timeout.
+		sub.enqueue(update, 10*time.Millisecond)
+		select {
+		case <-sub.kicked:
+		default:
+			t.Error("Expected subscriber to be disconnected")
+		}
+	})
+}